@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/rs/zerolog"
+)
+
+// autoApprove evaluates a grant waiting for approval against the policy engine, and approves it with
+// the credentials configured for grant.auto_approve when a rule matches. Groups are the requester's
+// groups, if known, and the decision and approval are logged with l. It returns the resulting grant and the decision, which is nil when
+// the grant was not evaluated. If approving fails, the decision no longer approves and says so, as the
+// grant still waits for manual approval.
+func autoApprove(ctx context.Context, l *zerolog.Logger, credentials *services.Credentials, engine *policy.Engine, parent services.Parent, entitlement string, grant *privilegedaccessmanagerpb.Grant, groups []string) (*privilegedaccessmanagerpb.Grant, *policy.Decision, error) {
+	if engine == nil || grant.GetState() != privilegedaccessmanagerpb.Grant_APPROVAL_AWAITED {
+		return grant, nil, nil
+	}
+
+	req := policy.Request{
+		Requester:     grant.GetRequester(),
+		Groups:        groups,
+		Parent:        parent.Resource,
+		Entitlement:   entitlement,
+		Duration:      grant.GetRequestedDuration().AsDuration(),
+		Justification: grant.GetJustification().GetUnstructuredJustification(),
+		Time:          time.Now(),
+	}
+	for _, binding := range grant.GetPrivilegedAccess().GetGcpIamAccess().GetRoleBindings() {
+		req.Roles = append(req.Roles, binding.Role)
+	}
+
+	decision := engine.Evaluate(req)
+
+	l.Info().
+		Str("grant", grant.Name).
+		Str("requester", grant.GetRequester()).
+		Bool("approve", decision.Approve).
+		Str("rule", decision.Rule).
+		Str("reason", decision.Reason).
+		Msg("Evaluated auto-approval policy")
+
+	if !decision.Approve {
+		return grant, &decision, nil
+	}
+
+	mode := credentials.Mode(services.OperationGrantAutoApprove)
+	service, err := services.NewPAMService(ctx, credentials.TokenSource(mode))
+	if err != nil {
+		return grant, approvalFailed(decision), err
+	}
+	defer service.Close()
+
+	reason := fmt.Sprintf("Auto-approved by policy rule %s", decision.Rule)
+	approved, err := service.ApproveGrant(ctx, parent, entitlement, resourceID(grant.Name), reason)
+	if err != nil {
+		return grant, approvalFailed(decision), fmt.Errorf("failed to auto-approve grant: %v", err)
+	}
+
+	event := l.Info().
+		Str("audit", services.OperationGrantAutoApprove).
+		Str("grant", approved.Name).
+		Str("rule", decision.Rule).
+		Str("reason", reason).
+		Str("credentials", string(mode))
+	if mode == services.CredentialsImpersonate {
+		event = event.Str("service_account", credentials.ServiceAccount())
+	}
+	event.Msg("Auto-approved grant")
+
+	return approved, &decision, nil
+}
+
+// approvalFailed is the decision of a matching rule whose grant could not be approved
+func approvalFailed(decision policy.Decision) *policy.Decision {
+	return &policy.Decision{
+		Rule:   decision.Rule,
+		Reason: fmt.Sprintf("matched rule %s but auto-approval failed, manual approval required", decision.Rule),
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	credentialsContextKey    = "credentials"
+	serviceAccountContextKey = "service_account"
+	credentialsHeader        = "X-Credentials"
+)
+
+// logger returns the logger for the request, with the caller's email when they are authenticated
+func logger(c *gin.Context) *zerolog.Logger {
+	principal := middleware.CurrentPrincipal(c)
+	if principal == nil {
+		return &log.Logger
+	}
+
+	l := log.With().Str("user", principal.Email).Logger()
+	return &l
+}
+
+// setCredentials records the credential mode PAM is called with for the request
+func setCredentials(c *gin.Context, mode services.CredentialMode) {
+	c.Set(credentialsContextKey, string(mode))
+	c.Header(credentialsHeader, string(mode))
+}
+
+// audit starts an audit event for an action the caller took, e.g. grant.revoke. The event is logged
+// with the caller's identity, how they authenticated and the credentials PAM was called with, and is
+// sent with Msg.
+func audit(c *gin.Context, action string) *zerolog.Event {
+	event := log.Info().Str("audit", action)
+
+	if principal := middleware.CurrentPrincipal(c); principal != nil {
+		event = event.
+			Str("user", principal.Email).
+			Str("subject", principal.Subject).
+			Str("token_type", principal.TokenType).
+			Strs("groups", principal.Groups)
+	}
+
+	if credentials := c.GetString(credentialsContextKey); credentials != "" {
+		event = event.Str("credentials", credentials)
+	}
+	if serviceAccount := c.GetString(serviceAccountContextKey); serviceAccount != "" {
+		event = event.Str("service_account", serviceAccount)
+	}
+
+	return event
+}
@@ -1,38 +1,213 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/thoughtgears/pam-manager/internal/cookie"
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+	"github.com/thoughtgears/pam-manager/internal/session"
+	"github.com/thoughtgears/pam-manager/internal/tokencache"
 	"github.com/thoughtgears/pam-manager/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// stateCookie holds the state and PKCE verifier of a login until its callback
+	stateCookie = "pam_oauth_state"
+	// stateCookiePath limits the state cookie to the callback
+	stateCookiePath = "/auth/google/callback"
+	// loginTimeout is how long a login has to come back to the callback
+	loginTimeout = 10 * time.Minute
 )
 
 type AuthHandler struct {
 	authService *services.AuthService
+	cookies     *cookie.Signer
+	sessions    *session.Store
+	tokens      *tokencache.Cache
 }
 
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+// NewAuthHandler creates the login handlers. Revoked tokens are removed from tokens, the cache
+// of validated access tokens.
+func NewAuthHandler(authService *services.AuthService, cookies *cookie.Signer, sessions *session.Store, tokens *tokencache.Cache) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+		cookies:     cookies,
+		sessions:    sessions,
+		tokens:      tokens,
+	}
 }
 
+// Login starts a login with a random state and PKCE verifier, both kept in a signed cookie
+// so the callback can check that it belongs to a login started by this browser
 func (h *AuthHandler) Login(c *gin.Context) {
-	url := h.authService.GetLoginURL("state-token")
+	state, err := randomString()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	value := h.cookies.Encode(stateCookie, state+" "+verifier, time.Now().Add(loginTimeout))
+	setCookie(c, stateCookie, value, stateCookiePath, int(loginTimeout.Seconds()))
+
+	url := h.authService.GetLoginURL(state, verifier)
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
 func (h *AuthHandler) Callback(c *gin.Context) {
+	encoded, err := c.Cookie(stateCookie)
+	setCookie(c, stateCookie, "", stateCookiePath, -1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing login state, start the login again"})
+		return
+	}
+
+	value, err := h.cookies.Decode(stateCookie, encoded, time.Now())
+	if err != nil {
+		log.Warn().Err(err).Msg("Invalid login state cookie")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state, start the login again"})
+		return
+	}
+
+	state, verifier, _ := strings.Cut(value, " ")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		log.Warn().Msg("Login state does not match")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login state does not match"})
+		return
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed: " + reason})
+		return
+	}
+
 	code := c.Query("code")
-	token, err := h.authService.HandleCallback(c.Request.Context(), code)
+	token, claims, err := h.authService.HandleCallback(c.Request.Context(), code, verifier)
+	if errors.Is(err, services.ErrInvalidIDToken) {
+		log.Warn().Err(err).Msg("Login rejected")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login rejected"})
+		return
+	}
 	if err != nil {
+		log.Error().Err(err).Msg("Failed to exchange token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange token"})
 		return
 	}
 
-	// Return relevant token information
+	principal := middleware.PrincipalFromClaims(claims, middleware.TokenTypeSession)
+	if scope, ok := token.Extra("scope").(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	}
+
+	// The token source outlives the request, so it must not refresh with the request context
+	tokenSource := h.authService.TokenSource(context.Background(), token)
+
+	s, value, err := h.sessions.Create(*principal, tokenSource, token.RefreshToken)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	setCookie(c, session.CookieName, value, "/", int(h.sessions.TTL().Seconds()))
+
+	log.Info().Str("user", principal.Email).Str("subject", principal.Subject).Msg("Logged in")
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":     "Authentication successful",
-		"accessToken": token.AccessToken,
-		"expiry":      token.Expiry,
+		"message": "Authentication successful",
+		"user":    principal.Email,
+		"expiry":  s.Expires,
 	})
 }
+
+// Refresh mints a new access token for the session from its refresh token, e.g. after the user's
+// permissions changed. The token stays on the server, only its expiry is returned.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	s, ok := h.sessions.Load(c.Request)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No session"})
+		return
+	}
+
+	if s.RefreshToken == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session has no refresh token, log in again"})
+		return
+	}
+
+	token, err := h.authService.Refresh(c.Request.Context(), s.RefreshToken)
+	if err != nil {
+		log.Error().Err(err).Str("user", s.Principal.Email).Msg("Failed to refresh token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to refresh token, log in again"})
+		return
+	}
+
+	h.sessions.SetToken(s.ID, h.authService.TokenSource(context.Background(), token), token.RefreshToken)
+
+	c.JSON(http.StatusOK, gin.H{"user": s.Principal.Email, "expiry": token.Expiry})
+}
+
+// Logout ends the session and revokes its tokens at Google. Without a session, the bearer token
+// in the Authorization header is revoked instead.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var token, user string
+	if s, ok := h.sessions.Load(c.Request); ok {
+		h.sessions.Delete(s.ID)
+		setCookie(c, session.CookieName, "", "/", -1)
+
+		token, user = s.RefreshToken, s.Principal.Email
+		if token == "" {
+			if t, err := s.Token.Token(); err == nil {
+				token = t.AccessToken
+			}
+		}
+	} else if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No session or token"})
+		return
+	}
+
+	if token != "" {
+		h.tokens.Remove(token)
+		if err := h.authService.Revoke(c.Request.Context(), token); err != nil {
+			log.Error().Err(err).Str("user", user).Msg("Failed to revoke token")
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Logged out, but failed to revoke the token at Google"})
+			return
+		}
+	}
+
+	log.Info().Str("user", user).Msg("Logged out")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// setCookie sets an HTTP only cookie, secure unless the request came over plain HTTP. A negative
+// maxAge deletes the cookie.
+func setCookie(c *gin.Context, name, value, path string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, path, "", secure, true)
+}
+
+// randomString returns 32 random bytes, base64 URL encoded
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
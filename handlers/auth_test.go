@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/cookie"
+	"github.com/thoughtgears/pam-manager/internal/idtoken"
+	"github.com/thoughtgears/pam-manager/internal/idtoken/idtokentest"
+	"github.com/thoughtgears/pam-manager/internal/session"
+	"github.com/thoughtgears/pam-manager/internal/tokencache"
+	"github.com/thoughtgears/pam-manager/models"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+const testClientID = "client-id"
+
+// fakeGoogle stands in for Google's OAuth token and revoke endpoints, and signs the ID tokens it
+// returns with a key served by a fake JWKS endpoint
+type fakeGoogle struct {
+	*httptest.Server
+	jwks *idtokentest.Server
+	key  crypto.Signer
+
+	mu        sync.Mutex
+	exchanges []url.Values
+	revoked   []string
+	// rotate makes refreshes return a new refresh token
+	rotate bool
+	// revokeStatus is the status of the revoke endpoint, 200 if not set
+	revokeStatus int
+}
+
+func newFakeGoogle(t *testing.T) *fakeGoogle {
+	t.Helper()
+
+	g := &fakeGoogle{jwks: idtokentest.NewServer(t)}
+	g.key = g.jwks.AddRSAKey(t, "key")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		g.mu.Lock()
+		g.exchanges = append(g.exchanges, r.PostForm)
+		g.mu.Unlock()
+
+		if r.PostForm.Get("grant_type") == "refresh_token" {
+			g.refresh(w, r.PostForm.Get("refresh_token"))
+			return
+		}
+
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "good-code" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		verified := true
+		idToken := idtokentest.Sign(t, "key", g.key, idtoken.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "https://accounts.google.com",
+				Subject:   "123",
+				Audience:  jwt.ClaimStrings{testClientID},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			Email:         "jane@example.com",
+			EmailVerified: &verified,
+			HostedDomain:  "example.com",
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-1",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-1",
+			"scope":         "openid https://www.googleapis.com/auth/cloud-platform",
+			"id_token":      idToken,
+		})
+	})
+	mux.HandleFunc("POST /revoke", func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		g.revoked = append(g.revoked, r.FormValue("token"))
+		if g.revokeStatus != 0 {
+			w.WriteHeader(g.revokeStatus)
+		}
+	})
+	g.Server = httptest.NewServer(mux)
+	t.Cleanup(g.Close)
+
+	return g
+}
+
+func (g *fakeGoogle) refresh(w http.ResponseWriter, refreshToken string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.HasPrefix(refreshToken, "refresh-") {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	response := map[string]any{"access_token": "access-" + refreshToken, "token_type": "Bearer", "expires_in": 3600}
+	if g.rotate {
+		response["refresh_token"] = refreshToken + "-rotated"
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// Revoked returns the tokens posted to the revoke endpoint
+func (g *fakeGoogle) Revoked() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string(nil), g.revoked...)
+}
+
+// Exchanges returns the forms posted to the token endpoint
+func (g *fakeGoogle) Exchanges() []url.Values {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]url.Values(nil), g.exchanges...)
+}
+
+type authTest struct {
+	google   *fakeGoogle
+	cookies  *cookie.Signer
+	sessions *session.Store
+	tokens   *tokencache.Cache
+	engine   *gin.Engine
+}
+
+func newAuthTest(t *testing.T) *authTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	google := newFakeGoogle(t)
+	endpoint := oauth2.Endpoint{AuthURL: google.URL + "/auth", TokenURL: google.URL + "/token", AuthStyle: oauth2.AuthStyleInParams}
+	verifier := idtoken.NewVerifier(google.jwks.URL, idtoken.GoogleIssuers, []string{testClientID}, nil)
+	authService := services.NewAuthService(testClientID, "secret", "https://pam.example.com/auth/google/callback", endpoint, google.URL+"/revoke", verifier)
+
+	cookies, err := cookie.NewSigner("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := &authTest{
+		google:  google,
+		cookies: cookies,
+		tokens:  tokencache.New(10, time.Minute, time.Minute),
+		engine:  gin.New(),
+	}
+	test.sessions = session.NewStore(test.cookies, time.Hour)
+
+	h := NewAuthHandler(authService, test.cookies, test.sessions, test.tokens)
+	test.engine.GET("/auth/google/login", h.Login)
+	test.engine.GET("/auth/google/callback", h.Callback)
+	test.engine.POST("/auth/refresh", h.Refresh)
+	test.engine.POST("/auth/logout", h.Logout)
+
+	return test
+}
+
+func (a *authTest) do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// login runs a login through the fake Google and returns the session cookie
+func (a *authTest) login(t *testing.T) *http.Cookie {
+	t.Helper()
+
+	rec := a.do(httptest.NewRequest(http.MethodGet, "/auth/google/login", nil))
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=good-code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+	req.AddCookie(responseCookie(rec, stateCookie))
+	rec = a.do(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	sessionCookie := responseCookie(rec, session.CookieName)
+	if sessionCookie == nil {
+		t.Fatal("callback did not set the session cookie")
+	}
+
+	return sessionCookie
+}
+
+// session returns the session of the cookie
+func (a *authTest) session(sessionCookie *http.Cookie) (*session.Session, bool) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(sessionCookie)
+	return a.sessions.Load(req)
+}
+
+func TestCallbackForwardsPKCEVerifier(t *testing.T) {
+	test := newAuthTest(t)
+
+	rec := test.do(httptest.NewRequest(http.MethodGet, "/auth/google/login", nil))
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("login URL has no S256 code challenge: %s", location)
+	}
+
+	stateCookieValue := responseCookie(rec, stateCookie)
+	if stateCookieValue == nil || stateCookieValue.Path != stateCookiePath || !stateCookieValue.HttpOnly {
+		t.Fatalf("state cookie = %+v, want an HTTP only cookie for %s", stateCookieValue, stateCookiePath)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=good-code&state="+url.QueryEscape(query.Get("state")), nil)
+	req.AddCookie(stateCookieValue)
+	rec = test.do(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	exchanges := test.google.Exchanges()
+	if len(exchanges) != 1 {
+		t.Fatalf("token exchanges = %d, want 1", len(exchanges))
+	}
+	sum := sha256.Sum256([]byte(exchanges[0].Get("code_verifier")))
+	if challenge := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != query.Get("code_challenge") {
+		t.Errorf("code_verifier does not match the code challenge of the login")
+	}
+
+	var body struct {
+		User string `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.User != "jane@example.com" {
+		t.Errorf("user = %q, want jane@example.com", body.User)
+	}
+	if strings.Contains(rec.Body.String(), "access-1") {
+		t.Error("callback returned the access token")
+	}
+
+	sessionCookie := responseCookie(rec, session.CookieName)
+	if sessionCookie == nil {
+		t.Fatal("callback did not set the session cookie")
+	}
+	s, ok := test.session(sessionCookie)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if !s.Principal.EmailVerified || s.Principal.HostedDomain != "example.com" {
+		t.Errorf("session principal = %+v, want the verified claims of the ID token", s.Principal)
+	}
+}
+
+func TestCallbackRejectsLoginState(t *testing.T) {
+	test := newAuthTest(t)
+	now := time.Now()
+
+	valid := test.cookies.Encode(stateCookie, "state-a verifier", now.Add(time.Minute))
+	_, rest, _ := strings.Cut(valid, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte("state-b verifier")) + "." + rest
+
+	otherSigner, err := cookie.NewSigner("another secret of at least 32 bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+	}{
+		{"missing cookie", "", "state-a"},
+		{"state mismatch", valid, "state-b"},
+		{"expired cookie", test.cookies.Encode(stateCookie, "state-a verifier", now.Add(-time.Minute)), "state-a"},
+		{"tampered cookie", tampered, "state-b"},
+		{"cookie signed with another secret", otherSigner.Encode(stateCookie, "state-a verifier", now.Add(time.Minute)), "state-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=good-code&state="+tt.state, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: stateCookie, Value: tt.cookie})
+			}
+
+			rec := test.do(req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if responseCookie(rec, session.CookieName) != nil {
+				t.Error("a session was started")
+			}
+		})
+	}
+
+	if exchanges := test.google.Exchanges(); len(exchanges) != 0 {
+		t.Errorf("token exchanges = %d, want none", len(exchanges))
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	test := newAuthTest(t)
+	sessionCookie := test.login(t)
+
+	refresh := func() {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.AddCookie(sessionCookie)
+		if rec := test.do(req); rec.Code != http.StatusOK {
+			t.Fatalf("refresh status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+
+	// Google rotates the refresh token, the new one is kept
+	test.google.mu.Lock()
+	test.google.rotate = true
+	test.google.mu.Unlock()
+	refresh()
+
+	s, ok := test.session(sessionCookie)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if s.RefreshToken != "refresh-1-rotated" {
+		t.Errorf("refresh token = %q, want refresh-1-rotated", s.RefreshToken)
+	}
+	token, err := s.Token.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access-refresh-1" {
+		t.Errorf("access token = %q, want access-refresh-1", token.AccessToken)
+	}
+
+	// Google does not rotate it, the current one is kept
+	test.google.mu.Lock()
+	test.google.rotate = false
+	test.google.mu.Unlock()
+	refresh()
+
+	exchanges := test.google.Exchanges()
+	if got := exchanges[len(exchanges)-1].Get("refresh_token"); got != "refresh-1-rotated" {
+		t.Errorf("refreshed with %q, want the rotated refresh token", got)
+	}
+	if s, _ := test.session(sessionCookie); s.RefreshToken != "refresh-1-rotated" {
+		t.Errorf("refresh token = %q, want refresh-1-rotated", s.RefreshToken)
+	}
+}
+
+func TestRefreshWithoutSession(t *testing.T) {
+	test := newAuthTest(t)
+
+	if rec := test.do(httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestLogoutRevokesSessionRefreshToken(t *testing.T) {
+	test := newAuthTest(t)
+	sessionCookie := test.login(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(sessionCookie)
+	rec := test.do(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	if revoked := test.google.Revoked(); len(revoked) != 1 || revoked[0] != "refresh-1" {
+		t.Errorf("revoked = %v, want the refresh token", revoked)
+	}
+	if _, ok := test.session(sessionCookie); ok {
+		t.Error("session still exists")
+	}
+	if c := responseCookie(rec, session.CookieName); c == nil || c.MaxAge >= 0 {
+		t.Errorf("session cookie = %+v, want it deleted", c)
+	}
+}
+
+func TestLogoutRevokesBearerToken(t *testing.T) {
+	test := newAuthTest(t)
+	test.tokens.Add("bearer-token", &models.Principal{Email: "jane@example.com"}, time.Hour)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer bearer-token")
+	rec := test.do(req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	if revoked := test.google.Revoked(); len(revoked) != 1 || revoked[0] != "bearer-token" {
+		t.Errorf("revoked = %v, want the bearer token", revoked)
+	}
+	if _, found := test.tokens.Get("bearer-token"); found {
+		t.Error("revoked token is still cached")
+	}
+}
+
+func TestLogoutRevocationFails(t *testing.T) {
+	test := newAuthTest(t)
+	sessionCookie := test.login(t)
+
+	test.google.mu.Lock()
+	test.google.revokeStatus = http.StatusBadRequest
+	test.google.mu.Unlock()
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(sessionCookie)
+	if rec := test.do(req); rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+
+	// The session ends even if Google could not be reached
+	if _, ok := test.session(sessionCookie); ok {
+		t.Error("session still exists")
+	}
+}
+
+func TestLogoutWithoutSessionOrToken(t *testing.T) {
+	test := newAuthTest(t)
+
+	if rec := test.do(httptest.NewRequest(http.MethodPost, "/auth/logout", nil)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if revoked := test.google.Revoked(); len(revoked) != 0 {
+		t.Errorf("revoked = %v, want none", revoked)
+	}
+}
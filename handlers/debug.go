@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 
+	"net/http"
 	"strings"
 
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog/log"
@@ -51,3 +54,10 @@ func Debug(c *gin.Context) {
 
 	c.JSON(200, gin.H{"message": "Debug complete"})
 }
+
+// TokenCacheStats returns the hit and miss counters of the token validation cache
+func TokenCacheStats(authenticator *middleware.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"token_cache": authenticator.TokenCacheStats()})
+	}
+}
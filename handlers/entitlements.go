@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/thoughtgears/pam-manager/models"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func (h *PamHandler) GetEntitlements(c *gin.Context) {
+	service, ok := h.service(c, services.OperationEntitlementList)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
+
+	entitlementsResponse, err := service.GetEntitlements(c, parent)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to get entitlements")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get entitlements"})
+		return
+	}
+
+	entitlements := []models.Entitlement{}
+	for _, entitlement := range entitlementsResponse {
+		entitlements = append(entitlements, newEntitlement(entitlement))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entitlements": entitlements})
+}
+
+func (h *PamHandler) GetEntitlement(c *gin.Context) {
+	service, ok := h.service(c, services.OperationEntitlementGet)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	id := c.Param("id")
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
+
+	entitlementResponse, err := service.GetEntitlement(c, parent, id)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entitlement not found"})
+			return
+		}
+		logger(c).Error().Err(err).Msg("Failed to get entitlement")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get entitlement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entitlement": newEntitlement(entitlementResponse)})
+}
+
+func (h *PamHandler) CreateEntitlement(c *gin.Context) {
+	service, ok := h.service(c, services.OperationEntitlementCreate)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	var req struct {
+		parentRequest
+		EntitlementID        string                   `json:"entitlement_id" binding:"required"`
+		EligibleUsers        []string                 `json:"eligible_users" binding:"required,min=1,dive,required"`
+		ApprovalWorkflow     *models.ApprovalWorkflow `json:"approval_workflow"`
+		MaxDuration          int64                    `json:"max_duration" binding:"required"`
+		RoleBindings         []models.RoleBinding     `json:"role_bindings" binding:"required,dive"`
+		RequireJustification bool                     `json:"require_justification"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	parent, ok := bindParent(c, req.parentRequest)
+	if !ok {
+		return
+	}
+
+	entitlement := &privilegedaccessmanagerpb.Entitlement{
+		EligibleUsers:                []*privilegedaccessmanagerpb.AccessControlEntry{{Principals: req.EligibleUsers}},
+		ApprovalWorkflow:             approvalWorkflowProto(req.ApprovalWorkflow),
+		PrivilegedAccess:             privilegedAccessProto(parent, req.RoleBindings),
+		MaxRequestDuration:           &durationpb.Duration{Seconds: req.MaxDuration},
+		RequesterJustificationConfig: justificationConfigProto(req.RequireJustification),
+	}
+
+	if async(c) {
+		operation, err := service.CreateEntitlementAsync(c, parent, req.EntitlementID, entitlement)
+		if err != nil {
+			logger(c).Error().Err(err).Msg("Failed to create entitlement")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create entitlement"})
+			return
+		}
+
+		audit(c, "entitlement.create").Str("entitlement", parent.EntitlementName(req.EntitlementID)).Str("operation", operation).Msg("Started creating entitlement")
+		acceptOperation(c, operation)
+		return
+	}
+
+	entitlementResponse, err := service.CreateEntitlement(c, parent, req.EntitlementID, entitlement)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to create entitlement")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create entitlement"})
+		return
+	}
+
+	audit(c, "entitlement.create").Str("entitlement", entitlementResponse.Name).Msg("Created entitlement")
+
+	c.JSON(http.StatusCreated, gin.H{"entitlement": newEntitlement(entitlementResponse)})
+}
+
+// UpdateEntitlement updates the fields present in the payload, fields that are left out are not changed
+func (h *PamHandler) UpdateEntitlement(c *gin.Context) {
+	service, ok := h.service(c, services.OperationEntitlementUpdate)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	id := c.Param("id")
+
+	var req struct {
+		parentRequest
+		EligibleUsers        []string                 `json:"eligible_users" binding:"omitempty,min=1,dive,required"`
+		ApprovalWorkflow     *models.ApprovalWorkflow `json:"approval_workflow"`
+		RemoveApproval       bool                     `json:"remove_approval_workflow"`
+		MaxDuration          int64                    `json:"max_duration"`
+		RoleBindings         []models.RoleBinding     `json:"role_bindings" binding:"omitempty,dive"`
+		RequireJustification *bool                    `json:"require_justification"`
+		Etag                 string                   `json:"etag"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	parent, ok := bindParent(c, req.parentRequest)
+	if !ok {
+		return
+	}
+
+	entitlement := &privilegedaccessmanagerpb.Entitlement{
+		Name: parent.EntitlementName(id),
+		Etag: req.Etag,
+	}
+
+	var paths []string
+	if req.EligibleUsers != nil {
+		entitlement.EligibleUsers = []*privilegedaccessmanagerpb.AccessControlEntry{{Principals: req.EligibleUsers}}
+		paths = append(paths, "eligible_users")
+	}
+	if req.ApprovalWorkflow != nil || req.RemoveApproval {
+		entitlement.ApprovalWorkflow = approvalWorkflowProto(req.ApprovalWorkflow)
+		paths = append(paths, "approval_workflow")
+	}
+	if req.MaxDuration > 0 {
+		entitlement.MaxRequestDuration = &durationpb.Duration{Seconds: req.MaxDuration}
+		paths = append(paths, "max_request_duration")
+	}
+	if req.RoleBindings != nil {
+		entitlement.PrivilegedAccess = privilegedAccessProto(parent, req.RoleBindings)
+		paths = append(paths, "privileged_access")
+	}
+	if req.RequireJustification != nil {
+		entitlement.RequesterJustificationConfig = justificationConfigProto(*req.RequireJustification)
+		paths = append(paths, "requester_justification_config")
+	}
+
+	if len(paths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	if async(c) {
+		operation, err := service.UpdateEntitlementAsync(c, entitlement, paths)
+		if err != nil {
+			logger(c).Error().Err(err).Msg("Failed to update entitlement")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update entitlement"})
+			return
+		}
+
+		audit(c, "entitlement.update").Str("entitlement", entitlement.Name).Str("operation", operation).Msg("Started updating entitlement")
+		acceptOperation(c, operation)
+		return
+	}
+
+	entitlementResponse, err := service.UpdateEntitlement(c, entitlement, paths)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to update entitlement")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update entitlement"})
+		return
+	}
+
+	audit(c, "entitlement.update").Str("entitlement", entitlementResponse.Name).Msg("Updated entitlement")
+
+	c.JSON(http.StatusOK, gin.H{"entitlement": newEntitlement(entitlementResponse)})
+}
+
+func (h *PamHandler) DeleteEntitlement(c *gin.Context) {
+	service, ok := h.service(c, services.OperationEntitlementDelete)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	id := c.Param("id")
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
+
+	force, _ := strconv.ParseBool(c.Query("force"))
+
+	if async(c) {
+		operation, err := service.DeleteEntitlementAsync(c, parent, id, force)
+		if err != nil {
+			logger(c).Error().Err(err).Msg("Failed to delete entitlement")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete entitlement"})
+			return
+		}
+
+		audit(c, "entitlement.delete").Str("entitlement", parent.EntitlementName(id)).Str("operation", operation).Msg("Started deleting entitlement")
+		acceptOperation(c, operation)
+		return
+	}
+
+	entitlementResponse, err := service.DeleteEntitlement(c, parent, id, force)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to delete entitlement")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete entitlement"})
+		return
+	}
+
+	audit(c, "entitlement.delete").Str("entitlement", entitlementResponse.Name).Msg("Deleted entitlement")
+
+	c.JSON(http.StatusOK, gin.H{"entitlement": newEntitlement(entitlementResponse)})
+}
+
+// newEntitlement maps a PAM entitlement to the API model
+func newEntitlement(entitlement *privilegedaccessmanagerpb.Entitlement) models.Entitlement {
+	e := models.Entitlement{
+		ID:                   resourceID(entitlement.Name),
+		Name:                 entitlement.Name,
+		State:                entitlement.State.String(),
+		MaxDuration:          entitlement.MaxRequestDuration.GetSeconds(),
+		RequireJustification: entitlement.RequesterJustificationConfig.GetUnstructured() != nil,
+		Etag:                 entitlement.Etag,
+	}
+
+	for _, entry := range entitlement.EligibleUsers {
+		e.EligibleUsers = append(e.EligibleUsers, entry.Principals...)
+	}
+
+	if steps := entitlement.ApprovalWorkflow.GetManualApprovals().GetSteps(); len(steps) > 0 {
+		e.ApprovalWorkflow = &models.ApprovalWorkflow{
+			ApprovalsNeeded:              steps[0].ApprovalsNeeded,
+			RequireApproverJustification: entitlement.ApprovalWorkflow.GetManualApprovals().RequireApproverJustification,
+		}
+		for _, entry := range steps[0].Approvers {
+			e.ApprovalWorkflow.Approvers = append(e.ApprovalWorkflow.Approvers, entry.Principals...)
+		}
+	}
+
+	for _, binding := range entitlement.PrivilegedAccess.GetGcpIamAccess().GetRoleBindings() {
+		e.RoleBindings = append(e.RoleBindings, models.RoleBinding{
+			Role:                binding.Role,
+			ConditionExpression: binding.ConditionExpression,
+		})
+	}
+
+	return e
+}
+
+func approvalWorkflowProto(workflow *models.ApprovalWorkflow) *privilegedaccessmanagerpb.ApprovalWorkflow {
+	if workflow == nil {
+		return nil
+	}
+
+	approvalsNeeded := workflow.ApprovalsNeeded
+	if approvalsNeeded == 0 {
+		approvalsNeeded = 1
+	}
+
+	return &privilegedaccessmanagerpb.ApprovalWorkflow{
+		ApprovalWorkflow: &privilegedaccessmanagerpb.ApprovalWorkflow_ManualApprovals{
+			ManualApprovals: &privilegedaccessmanagerpb.ManualApprovals{
+				RequireApproverJustification: workflow.RequireApproverJustification,
+				Steps: []*privilegedaccessmanagerpb.ManualApprovals_Step{{
+					Approvers:       []*privilegedaccessmanagerpb.AccessControlEntry{{Principals: workflow.Approvers}},
+					ApprovalsNeeded: approvalsNeeded,
+				}},
+			},
+		},
+	}
+}
+
+func privilegedAccessProto(parent services.Parent, roleBindings []models.RoleBinding) *privilegedaccessmanagerpb.PrivilegedAccess {
+	access := &privilegedaccessmanagerpb.PrivilegedAccess_GcpIamAccess{
+		ResourceType: parent.ResourceType(),
+		Resource:     parent.FullResourceName(),
+	}
+
+	for _, binding := range roleBindings {
+		access.RoleBindings = append(access.RoleBindings, &privilegedaccessmanagerpb.PrivilegedAccess_GcpIamAccess_RoleBinding{
+			Role:                binding.Role,
+			ConditionExpression: binding.ConditionExpression,
+		})
+	}
+
+	return &privilegedaccessmanagerpb.PrivilegedAccess{
+		AccessType: &privilegedaccessmanagerpb.PrivilegedAccess_GcpIamAccess_{GcpIamAccess: access},
+	}
+}
+
+func justificationConfigProto(required bool) *privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig {
+	if required {
+		return &privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig{
+			JustificationType: &privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig_Unstructured_{
+				Unstructured: &privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig_Unstructured{},
+			},
+		}
+	}
+
+	return &privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig{
+		JustificationType: &privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig_NotMandatory_{
+			NotMandatory: &privilegedaccessmanagerpb.Entitlement_RequesterJustificationConfig_NotMandatory{},
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/thoughtgears/pam-manager/models"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	accessTypes = map[string]privilegedaccessmanagerpb.SearchEntitlementsRequest_CallerAccessType{
+		"requester": privilegedaccessmanagerpb.SearchEntitlementsRequest_GRANT_REQUESTER,
+		"approver":  privilegedaccessmanagerpb.SearchEntitlementsRequest_GRANT_APPROVER,
+	}
+
+	relationships = map[string]privilegedaccessmanagerpb.SearchGrantsRequest_CallerRelationshipType{
+		"created":      privilegedaccessmanagerpb.SearchGrantsRequest_HAD_CREATED,
+		"can_approve":  privilegedaccessmanagerpb.SearchGrantsRequest_CAN_APPROVE,
+		"had_approved": privilegedaccessmanagerpb.SearchGrantsRequest_HAD_APPROVED,
+	}
+)
+
+// MyEntitlements lists the entitlements the caller can request, or approve with access=approver
+func (h *PamHandler) MyEntitlements(c *gin.Context) {
+	service, ok := h.callerService(c)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
+
+	accessType, ok := accessTypes[c.DefaultQuery("access", "requester")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "access must be one of requester, approver"})
+		return
+	}
+
+	entitlementsResponse, err := service.SearchEntitlements(c, parent, accessType)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to search entitlements")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search entitlements"})
+		return
+	}
+
+	entitlements := []models.Entitlement{}
+	for _, entitlement := range entitlementsResponse {
+		entitlements = append(entitlements, newEntitlement(entitlement))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entitlements": entitlements})
+}
+
+// MyGrants lists the grants the caller created, or has the relationship given in the
+// relationship query parameter with
+func (h *PamHandler) MyGrants(c *gin.Context) {
+	h.searchGrants(c, c.DefaultQuery("relationship", "created"))
+}
+
+// MyApprovals lists the grants the caller can approve
+func (h *PamHandler) MyApprovals(c *gin.Context) {
+	h.searchGrants(c, "can_approve")
+}
+
+func (h *PamHandler) searchGrants(c *gin.Context, relationship string) {
+	service, ok := h.callerService(c)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
+
+	relationshipType, ok := relationships[relationship]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "relationship must be one of created, can_approve, had_approved"})
+		return
+	}
+
+	grantsResponse, err := service.SearchGrants(c, parent, c.DefaultQuery("entitlement", "-"), relationshipType)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to search grants")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search grants"})
+		return
+	}
+
+	grants := []models.Grant{}
+	for _, grant := range grantsResponse {
+		grants = append(grants, newGrant(grant))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/thoughtgears/pam-manager/models"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetOperation returns a long-running operation so callers of async requests can poll for the result
+func (h *PamHandler) GetOperation(c *gin.Context) {
+	service, ok := h.service(c, services.OperationOperationGet)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	name, ok := operationName(c)
+	if !ok {
+		return
+	}
+
+	op, err := service.GetOperation(c, name)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Operation not found"})
+			return
+		}
+		logger(c).Error().Err(err).Msg("Failed to get operation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get operation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"operation": newOperation(op)})
+}
+
+// operationName reads the operation name from the path, e.g. projects/my-project/locations/global/operations/123.
+// If it is invalid, the error response is written and false is returned.
+func operationName(c *gin.Context) (string, bool) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[2] != "locations" || parts[4] != "operations" || parts[5] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid operation name"})
+		return "", false
+	}
+
+	return name, true
+}
+
+// async reports whether the request asked to return the operation instead of waiting for it
+func async(c *gin.Context) bool {
+	async, _ := strconv.ParseBool(c.Query("async"))
+	return async
+}
+
+// acceptOperation responds to an async request with the operation to poll
+func acceptOperation(c *gin.Context, name string) {
+	c.Header("Location", "/pam/operations/"+name)
+	c.JSON(http.StatusAccepted, gin.H{"operation": name})
+}
+
+// newOperation maps a long-running operation to the API model
+func newOperation(op *longrunningpb.Operation) models.Operation {
+	o := models.Operation{
+		Name: op.Name,
+		Done: op.Done,
+	}
+
+	var metadata privilegedaccessmanagerpb.OperationMetadata
+	if op.Metadata != nil && op.Metadata.UnmarshalTo(&metadata) == nil {
+		o.Verb = metadata.Verb
+		o.Target = metadata.Target
+		o.CreateTime = metadata.CreateTime.AsTime()
+	}
+
+	if err := op.GetError(); err != nil {
+		o.Error = err.Message
+	}
+
+	if response := op.GetResponse(); response != nil {
+		var grant privilegedaccessmanagerpb.Grant
+		var entitlement privilegedaccessmanagerpb.Entitlement
+
+		switch {
+		case response.MessageIs(&grant) && response.UnmarshalTo(&grant) == nil:
+			g := newGrant(&grant)
+			o.Grant = &g
+		case response.MessageIs(&entitlement) && response.UnmarshalTo(&entitlement) == nil:
+			e := newEntitlement(&entitlement)
+			o.Entitlement = &e
+		}
+	}
+
+	return o
+}
@@ -4,97 +4,140 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+	"github.com/thoughtgears/pam-manager/internal/session"
 	"github.com/thoughtgears/pam-manager/models"
 	"github.com/thoughtgears/pam-manager/services"
 
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// defaultPageSize is the number of grants returned when no page_size is given
+const defaultPageSize = 100
+
 type PamHandler struct {
-	pamService *services.PAMService
+	slackService *services.SlackService
+	policy       *policy.Store
+	credentials  *services.Credentials
 }
 
-func NewPamHandler() *PamHandler {
-	return &PamHandler{}
+// NewPamHandler creates the PAM handlers, calling PAM with the credentials configured for each operation.
+// If policyStore is nil, grants are never auto-approved.
+func NewPamHandler(slackService *services.SlackService, policyStore *policy.Store, credentials *services.Credentials) *PamHandler {
+	return &PamHandler{
+		slackService: slackService,
+		policy:       policyStore,
+		credentials:  credentials,
+	}
 }
 
 func (h *PamHandler) GetGrants(c *gin.Context) {
-	service, err := services.NewPAMService(c, nil)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create PAM service")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PAM service"})
+	service, ok := h.service(c, services.OperationGrantList)
+	if !ok {
 		return
 	}
+	defer service.Close()
 
-	h.pamService = service
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
 
-	project := c.Query("project")
 	entitlement := c.Query("entitlement")
+	if entitlement == "" {
+		logger(c).Error().Msg("entitlement query parameter is required")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entitlement query parameter is required"})
+		return
+	}
+
+	var query struct {
+		PageSize  int    `form:"page_size" binding:"omitempty,min=1,max=1000"`
+		PageToken string `form:"page_token"`
+		Filter    string `form:"filter"`
+		OrderBy   string `form:"order_by"`
+	}
 
-	if project == "" || entitlement == "" {
-		log.Error().Msg("project and entitlement query parameters are required")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "project and entitlement query parameters are required"})
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 1000"})
 		return
 	}
 
-	grantsResponse, err := h.pamService.GetGrants(c, project, entitlement)
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	grantsResponse, nextPageToken, err := service.GetGrants(c, parent, entitlement, services.ListOptions{
+		PageSize:  query.PageSize,
+		PageToken: query.PageToken,
+		Filter:    query.Filter,
+		OrderBy:   query.OrderBy,
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get grants")
+		if status.Code(err) == codes.InvalidArgument {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page_token, filter or order_by"})
+			return
+		}
+		logger(c).Error().Err(err).Msg("Failed to get grants")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get grants"})
 		return
 	}
 
-	var grants []models.Grant
-
+	grants := []models.Grant{}
 	for _, grant := range grantsResponse {
-		var id string
-		parts := strings.Split(grant.Name, "/")
-		if len(parts) > 0 {
-			id = parts[len(parts)-1]
-		}
-
-		g := models.Grant{
-			ID:            id,
-			Name:          grant.Name,
-			Requester:     grant.Requester,
-			Duration:      grant.RequestedDuration.GetSeconds(),
-			Justification: grant.Justification.GetUnstructuredJustification(),
-			State:         grant.State.String(),
-		}
-
-		for _, role := range grant.PrivilegedAccess.GetGcpIamAccess().RoleBindings {
-			g.Roles = append(g.Roles, role.Role)
-		}
-
-		grants = append(grants, g)
+		grants = append(grants, newGrant(grant))
 	}
 
-	c.JSON(http.StatusOK, gin.H{"grants": grants})
+	c.JSON(http.StatusOK, gin.H{"grants": grants, "next_page_token": nextPageToken})
 }
 
-func (h *PamHandler) RequestGrant(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	authToken := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+func (h *PamHandler) GetGrant(c *gin.Context) {
+	service, ok := h.service(c, services.OperationGrantGet)
+	if !ok {
+		return
+	}
+	defer service.Close()
 
-	token := &oauth2.Token{
-		AccessToken: authToken,
-		TokenType:   "Bearer",
+	parent, ok := queryParent(c)
+	if !ok {
+		return
 	}
 
-	tokenSource := oauth2.StaticTokenSource(token)
-	service, err := services.NewPAMService(c, tokenSource)
+	id := c.Param("id")
+	entitlement := c.Query("entitlement")
+	if entitlement == "" {
+		logger(c).Error().Msg("entitlement query parameter is required")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entitlement query parameter is required"})
+		return
+	}
+
+	grantResponse, err := service.GetGrant(c, parent, entitlement, id)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create PAM service")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PAM service"})
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Grant not found"})
+			return
+		}
+		logger(c).Error().Err(err).Msg("Failed to get grant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get grant"})
 		return
 	}
 
-	h.pamService = service
+	c.JSON(http.StatusOK, gin.H{"grant": newGrant(grantResponse)})
+}
+
+func (h *PamHandler) RequestGrant(c *gin.Context) {
+	service, ok := h.service(c, services.OperationGrantRequest)
+	if !ok {
+		return
+	}
+	defer service.Close()
 
 	var req struct {
-		ProjectID   string `json:"project_id" binding:"required"`
+		parentRequest
 		Entitlement string `json:"entitlement" binding:"required"`
 		Reason      string `json:"reason" binding:"required"`
 		Duration    int64  `json:"duration" binding:"required"`
@@ -105,57 +148,84 @@ func (h *PamHandler) RequestGrant(c *gin.Context) {
 		return
 	}
 
-	grantResponse, err := h.pamService.RequestGrant(c, req.ProjectID, req.Entitlement, req.Reason, req.Duration)
+	parent, ok := bindParent(c, req.parentRequest)
+	if !ok {
+		return
+	}
+
+	grantResponse, err := service.RequestGrant(c, parent, req.Entitlement, req.Reason, req.Duration)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create grant")
+		logger(c).Error().Err(err).Msg("Failed to create grant")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create grant"})
 		return
 	}
-	var id string
-	parts := strings.Split(grantResponse.Name, "/")
-	if len(parts) > 0 {
-		id = parts[len(parts)-1]
-	}
 
-	grant := models.Grant{
-		ID:            id,
-		Name:          grantResponse.Name,
-		Requester:     grantResponse.Requester,
-		Duration:      grantResponse.RequestedDuration.GetSeconds(),
-		Justification: grantResponse.Justification.GetUnstructuredJustification(),
-		State:         grantResponse.State.String(),
+	audit(c, "grant.request").Str("grant", grantResponse.Name).Str("state", grantResponse.State.String()).Msg("Requested grant")
+
+	response := gin.H{}
+	grantResponse, decision, err := autoApprove(c, logger(c), h.credentials, h.policy.Engine(), parent, req.Entitlement, grantResponse, middleware.CurrentPrincipal(c).Groups)
+	if err != nil {
+		logger(c).Error().Err(err).Str("grant", grantResponse.Name).Msg("Failed to auto-approve grant")
+		response["auto_approve_error"] = "Failed to auto-approve grant, it waits for manual approval"
 	}
 
-	for _, role := range grantResponse.PrivilegedAccess.GetGcpIamAccess().RoleBindings {
-		grant.Roles = append(grant.Roles, role.Role)
+	if err := h.slackService.NotifyApprovers(c, grantResponse); err != nil {
+		logger(c).Error().Err(err).Str("grant", grantResponse.Name).Msg("Failed to notify approvers")
 	}
 
-	c.JSON(http.StatusOK, gin.H{"grant": grant})
+	response["grant"] = newGrant(grantResponse)
+	response["decision"] = decision
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *PamHandler) ApproveGrant(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	authToken := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	service, ok := h.service(c, services.OperationGrantApprove)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	id := c.Param("id")
 
-	token := &oauth2.Token{
-		AccessToken: authToken,
-		TokenType:   "Bearer",
+	var req struct {
+		parentRequest
+		Entitlement string `json:"entitlement" binding:"required"`
+		Reason      string `json:"reason" binding:"required"`
 	}
 
-	tokenSource := oauth2.StaticTokenSource(token)
-	service, err := services.NewPAMService(c, tokenSource)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	parent, ok := bindParent(c, req.parentRequest)
+	if !ok {
+		return
+	}
+
+	grantResponse, err := service.ApproveGrant(c, parent, req.Entitlement, id, req.Reason)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create PAM service")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PAM service"})
+		logger(c).Error().Err(err).Msg("Failed to approve grant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve grant"})
 		return
 	}
 
-	h.pamService = service
+	audit(c, "grant.approve").Str("grant", grantResponse.Name).Str("reason", req.Reason).Msg("Approved grant")
+
+	c.JSON(http.StatusOK, gin.H{"grant": newGrant(grantResponse)})
+}
+
+func (h *PamHandler) DenyGrant(c *gin.Context) {
+	service, ok := h.service(c, services.OperationGrantDeny)
+	if !ok {
+		return
+	}
+	defer service.Close()
 
 	id := c.Param("id")
 
 	var req struct {
-		ProjectID   string `json:"project_id" binding:"required"`
+		parentRequest
 		Entitlement string `json:"entitlement" binding:"required"`
 		Reason      string `json:"reason" binding:"required"`
 	}
@@ -165,53 +235,48 @@ func (h *PamHandler) ApproveGrant(c *gin.Context) {
 		return
 	}
 
-	grantResponse, err := h.pamService.ApproveGrant(c, id, req.ProjectID, req.Entitlement, req.Reason)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to approve grant")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve grant"})
+	parent, ok := bindParent(c, req.parentRequest)
+	if !ok {
 		return
 	}
 
-	grant := models.Grant{
-		ID:            id,
-		Name:          grantResponse.Name,
-		Requester:     grantResponse.Requester,
-		Duration:      grantResponse.RequestedDuration.GetSeconds(),
-		Justification: grantResponse.Justification.GetUnstructuredJustification(),
-		State:         grantResponse.State.String(),
+	grantResponse, err := service.DenyGrant(c, parent, req.Entitlement, id, req.Reason)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to deny grant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deny grant"})
+		return
 	}
 
-	for _, role := range grantResponse.PrivilegedAccess.GetGcpIamAccess().RoleBindings {
-		grant.Roles = append(grant.Roles, role.Role)
-	}
+	audit(c, "grant.deny").Str("grant", grantResponse.Name).Str("reason", req.Reason).Msg("Denied grant")
 
-	c.JSON(http.StatusOK, gin.H{"grant": grant})
+	c.JSON(http.StatusOK, gin.H{"grant": newGrant(grantResponse)})
 }
 
 func (h *PamHandler) RevokeGrant(c *gin.Context) {
-	service, err := services.NewPAMService(c, nil)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create PAM service")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PAM service"})
+	service, ok := h.service(c, services.OperationGrantRevoke)
+	if !ok {
 		return
 	}
+	defer service.Close()
 
-	h.pamService = service
+	parent, ok := queryParent(c)
+	if !ok {
+		return
+	}
 
 	id := c.Param("id")
-	project := c.Query("project")
 	entitlement := c.Query("entitlement")
 	reason := c.Query("reason")
 
 	if id == "" {
-		log.Error().Msg("id parameter is required")
+		logger(c).Error().Msg("id parameter is required")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
 		return
 	}
 
-	if project == "" || entitlement == "" {
-		log.Error().Msg("project and entitlement query parameters are required")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "project and entitlement query parameters are required"})
+	if entitlement == "" {
+		logger(c).Error().Msg("entitlement query parameter is required")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entitlement query parameter is required"})
 		return
 	}
 
@@ -219,25 +284,114 @@ func (h *PamHandler) RevokeGrant(c *gin.Context) {
 		reason = "Automated revocation, no reason provided"
 	}
 
-	grantResponse, err := h.pamService.RevokeGrant(c, id, project, entitlement, reason)
+	if async(c) {
+		operation, err := service.RevokeGrantAsync(c, parent, entitlement, id, reason)
+		if err != nil {
+			logger(c).Error().Err(err).Msg("Failed to revoke grant")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke grant"})
+			return
+		}
+
+		audit(c, "grant.revoke").Str("grant", parent.GrantName(entitlement, id)).Str("reason", reason).Str("operation", operation).Msg("Started revoking grant")
+		acceptOperation(c, operation)
+		return
+	}
+
+	grantResponse, err := service.RevokeGrant(c, parent, entitlement, id, reason)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to revoke grant")
+		logger(c).Error().Err(err).Msg("Failed to revoke grant")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke grant"})
 		return
 	}
 
-	grant := models.Grant{
-		ID:            id,
-		Name:          grantResponse.Name,
-		Requester:     grantResponse.Requester,
-		Duration:      grantResponse.RequestedDuration.GetSeconds(),
-		Justification: grantResponse.Justification.GetUnstructuredJustification(),
-		State:         grantResponse.State.String(),
+	audit(c, "grant.revoke").Str("grant", grantResponse.Name).Str("reason", reason).Msg("Revoked grant")
+
+	c.JSON(http.StatusOK, gin.H{"grant": newGrant(grantResponse)})
+}
+
+// service creates a PAM service with the credentials configured for the operation. The credential mode
+// is returned in the X-Credentials header and added to audit events. The caller must close the service.
+// If it fails, the error response is written and false is returned.
+func (h *PamHandler) service(c *gin.Context, operation string) (*services.PAMService, bool) {
+	mode := h.credentials.Mode(operation)
+	if mode == services.CredentialsCaller {
+		return h.callerService(c)
+	}
+
+	setCredentials(c, mode)
+	if mode == services.CredentialsImpersonate {
+		c.Set(serviceAccountContextKey, h.credentials.ServiceAccount())
+	}
+
+	service, err := services.NewPAMService(c, h.credentials.TokenSource(mode))
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to create PAM service")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PAM service"})
+		return nil, false
+	}
+
+	return service, true
+}
+
+// callerService creates a PAM service acting as the caller, with the refreshing token of their
+// session or their bearer access token. The caller must close the service. If it fails, the error
+// response is written and false is returned.
+func (h *PamHandler) callerService(c *gin.Context) (*services.PAMService, bool) {
+	setCredentials(c, services.CredentialsCaller)
+
+	var tokenSource oauth2.TokenSource
+	switch middleware.CurrentPrincipal(c).TokenType {
+	case middleware.TokenTypeSession:
+		s, _ := c.Get(middleware.SessionContextKey)
+		tokenSource = s.(*session.Session).Token
+	case middleware.TokenTypeAccess:
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			authHeader = c.GetHeader("X-Serverless-Authorization")
+		}
+		authToken := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+
+		tokenSource = oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: authToken,
+			TokenType:   "Bearer",
+		})
+	default:
+		// ID tokens and IAP assertions identify the caller, but cannot call PAM as them
+		c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint acts with your Google credentials, use an access token or log in"})
+		return nil, false
+	}
+
+	service, err := services.NewPAMService(c, tokenSource)
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Failed to create PAM service")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create PAM service"})
+		return nil, false
+	}
+
+	return service, true
+}
+
+// resourceID returns the last segment of a resource name
+func resourceID(name string) string {
+	parts := strings.Split(name, "/")
+	return parts[len(parts)-1]
+}
+
+// newGrant maps a PAM grant to the API model
+func newGrant(grant *privilegedaccessmanagerpb.Grant) models.Grant {
+	g := models.Grant{
+		ID:            resourceID(grant.Name),
+		Name:          grant.Name,
+		Requester:     grant.Requester,
+		Duration:      grant.RequestedDuration.GetSeconds(),
+		Justification: grant.Justification.GetUnstructuredJustification(),
+		State:         grant.State.String(),
+		CreateTime:    grant.CreateTime.AsTime(),
 	}
 
-	for _, role := range grantResponse.PrivilegedAccess.GetGcpIamAccess().RoleBindings {
-		grant.Roles = append(grant.Roles, role.Role)
+	for _, role := range grant.PrivilegedAccess.GetGcpIamAccess().GetRoleBindings() {
+		g.Roles = append(g.Roles, role.Role)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"grant": grantResponse})
+	return g
 }
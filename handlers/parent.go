@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/thoughtgears/pam-manager/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parentRequest addresses the parent of entitlements in JSON payloads. Parent is projects/{project},
+// folders/{folder} or organizations/{organization}, project_id is kept for compatibility and is the
+// same as parent projects/{project_id}. Location defaults to global.
+type parentRequest struct {
+	Parent    string `json:"parent"`
+	ProjectID string `json:"project_id"`
+	Location  string `json:"location"`
+}
+
+func (r parentRequest) parse() (services.Parent, error) {
+	resource := r.Parent
+	if resource == "" {
+		resource = r.ProjectID
+	}
+
+	return services.ParseParent(resource, r.Location)
+}
+
+// bindParent parses the parent of a JSON payload. If it is missing or invalid,
+// the error response is written and false is returned.
+func bindParent(c *gin.Context, r parentRequest) (services.Parent, bool) {
+	parent, err := r.parse()
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Invalid parent")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "parent or project_id must be a project, folder or organization"})
+		return services.Parent{}, false
+	}
+
+	return parent, true
+}
+
+// queryParent parses the parent from the parent (or project) and location query parameters. If it is
+// missing or invalid, the error response is written and false is returned.
+func queryParent(c *gin.Context) (services.Parent, bool) {
+	parent, err := parentRequest{
+		Parent:    c.Query("parent"),
+		ProjectID: c.Query("project"),
+		Location:  c.Query("location"),
+	}.parse()
+	if err != nil {
+		logger(c).Error().Err(err).Msg("Invalid parent")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "parent or project query parameter must be a project, folder or organization"})
+		return services.Parent{}, false
+	}
+
+	return parent, true
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EvaluatePolicy explains whether a grant request would be auto-approved, without requesting the grant.
+// It takes the same payload as RequestGrant and evaluates it as requested by the caller, reading the
+// entitlement with the caller's credentials unless configured otherwise. Rules match on the requester's
+// email, so callers without a verified email are rejected.
+func (h *PamHandler) EvaluatePolicy(c *gin.Context) {
+	principal := middleware.CurrentPrincipal(c)
+	if principal == nil || principal.Email == "" || !principal.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "A verified email is required to evaluate the policy"})
+		return
+	}
+
+	var req struct {
+		parentRequest
+		Entitlement string `json:"entitlement" binding:"required"`
+		Reason      string `json:"reason" binding:"required"`
+		Duration    int64  `json:"duration" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	parent, ok := bindParent(c, req.parentRequest)
+	if !ok {
+		return
+	}
+
+	service, ok := h.service(c, services.OperationPolicyEvaluate)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	// The roles of a request come from the entitlement
+	entitlement, err := service.GetEntitlement(c, parent, req.Entitlement)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entitlement not found"})
+			return
+		}
+		logger(c).Error().Err(err).Msg("Failed to get entitlement")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get entitlement"})
+		return
+	}
+
+	policyRequest := policy.Request{
+		Requester:     principal.Email,
+		Groups:        principal.Groups,
+		Parent:        parent.Resource,
+		Entitlement:   req.Entitlement,
+		Duration:      time.Duration(req.Duration) * time.Second,
+		Justification: req.Reason,
+		Time:          time.Now(),
+	}
+	for _, binding := range entitlement.GetPrivilegedAccess().GetGcpIamAccess().GetRoleBindings() {
+		policyRequest.Roles = append(policyRequest.Roles, binding.Role)
+	}
+
+	c.JSON(http.StatusOK, h.policy.Engine().Explain(policyRequest))
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+	"github.com/thoughtgears/pam-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEvaluatePolicyRequiresVerifiedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		principal  *models.Principal
+		wantStatus int
+	}{
+		{"no principal", nil, http.StatusForbidden},
+		{"no email", &models.Principal{Subject: "123", EmailVerified: true}, http.StatusForbidden},
+		{"unverified email", &models.Principal{Email: "jane@example.com"}, http.StatusForbidden},
+		// Verified callers get past the check, and the invalid payload is rejected before PAM is called
+		{"verified email", &models.Principal{Email: "jane@example.com", EmailVerified: true}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PamHandler{}
+			r := gin.New()
+			r.POST("/pam/policy/evaluate", func(c *gin.Context) {
+				if tt.principal != nil {
+					c.Set(middleware.PrincipalContextKey, tt.principal)
+				}
+			}, h.EvaluatePolicy)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/pam/policy/evaluate", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
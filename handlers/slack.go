@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/internal/rbac"
+	"github.com/thoughtgears/pam-manager/models"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+)
+
+const slackUsage = "Usage: `/pam request <project|parent> <entitlement> <duration> <reason>`, e.g. `/pam request my-project prod-admin 1h Investigating incident` or `/pam request folders/123 break-glass 30m Outage`"
+
+const (
+	// slackTimeout bounds the work for a slash command or interaction done after Slack got its answer
+	slackTimeout = time.Minute
+	// slackTokenType and slackCredentials describe how Slack users act in audit events
+	slackTokenType   = "slack"
+	slackCredentials = "delegated"
+)
+
+type SlackHandler struct {
+	slackService             *services.SlackService
+	policy                   *policy.Store
+	groups                   *services.GroupsService
+	roles                    *rbac.Policy
+	credentials              *services.Credentials
+	delegationServiceAccount string
+}
+
+// NewSlackHandler creates the Slack handler. Slack users need the same roles as API callers, the
+// requester role to request grants and the approver role to approve or deny them. Their groups are
+// looked up with groups for roles and auto-approval unless it is nil. Auto-approvals use the credentials
+// configured for grant.auto_approve.
+func NewSlackHandler(slackService *services.SlackService, policyStore *policy.Store, groups *services.GroupsService, roles *rbac.Policy, credentials *services.Credentials, delegationServiceAccount string) *SlackHandler {
+	return &SlackHandler{
+		slackService:             slackService,
+		policy:                   policyStore,
+		groups:                   groups,
+		roles:                    roles,
+		credentials:              credentials,
+		delegationServiceAccount: delegationServiceAccount,
+	}
+}
+
+// Command handles the /pam slash command. The Slack user is mapped to a Google identity
+// through the email on their Slack profile, and the grant is requested on their behalf.
+func (h *SlackHandler) Command(c *gin.Context) {
+	cmd, err := slack.SlashCommandParse(c.Request)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse slash command")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slash command payload"})
+		return
+	}
+
+	args := strings.Fields(cmd.Text)
+	if len(args) < 5 || args[0] != "request" {
+		c.JSON(http.StatusOK, ephemeral(slackUsage))
+		return
+	}
+
+	entitlement := args[2]
+	reason := strings.Join(args[4:], " ")
+
+	parent, err := services.ParseParent(args[1], "")
+	if err != nil {
+		c.JSON(http.StatusOK, ephemeral(fmt.Sprintf("Invalid project or parent `%s`. %s", args[1], slackUsage)))
+		return
+	}
+
+	duration, err := parseDuration(args[3])
+	if err != nil {
+		c.JSON(http.StatusOK, ephemeral(fmt.Sprintf("Invalid duration `%s`. %s", args[3], slackUsage)))
+		return
+	}
+
+	if h.delegationServiceAccount == "" {
+		log.Error().Msg("SLACK_DELEGATION_SERVICE_ACCOUNT is not configured")
+		c.JSON(http.StatusOK, ephemeral("Requesting grants from Slack is not configured"))
+		return
+	}
+
+	c.JSON(http.StatusOK, ephemeral(fmt.Sprintf("Requesting `%s` in `%s` for %s, I will reply here when it is done",
+		entitlement, parent.Resource, duration)))
+
+	// Slack expects an answer within 3 seconds, so the grant is requested after answering
+	// and the result is sent through the response URL
+	ctx, cancel := context.WithTimeout(context.Background(), slackTimeout)
+	go func() {
+		defer cancel()
+		h.requestGrant(ctx, cmd, parent, entitlement, duration, reason)
+	}()
+}
+
+// requestGrant requests the grant for the Slack user behind the command, and replies with the result
+func (h *SlackHandler) requestGrant(ctx context.Context, cmd slack.SlashCommand, parent services.Parent, entitlement string, duration time.Duration, reason string) {
+	principal, ok := h.authorize(ctx, cmd.UserID, cmd.ResponseURL, rbac.Requester)
+	if !ok {
+		return
+	}
+	email := principal.Email
+
+	service, ok := h.delegatedService(ctx, email, cmd.ResponseURL)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	grant, err := service.RequestGrant(ctx, parent, entitlement, reason, int64(duration.Seconds()))
+	if err != nil {
+		log.Error().Err(err).Str("email", email).Str("entitlement", parent.EntitlementName(entitlement)).Msg("Failed to create grant")
+		h.reply(ctx, cmd.ResponseURL, fmt.Sprintf("Failed to request `%s` in `%s`, check that the entitlement exists and that you are eligible for it", entitlement, parent.Resource))
+		return
+	}
+
+	h.audit(principal, cmd.UserID, "grant.request").Str("grant", grant.Name).Str("state", grant.State.String()).Msg("Requested grant")
+
+	l := log.With().Str("user", email).Logger()
+	grant, decision, err := autoApprove(ctx, &l, h.credentials, h.policy.Engine(), parent, entitlement, grant, principal.Groups)
+	if err != nil {
+		l.Error().Err(err).Str("grant", grant.Name).Msg("Failed to auto-approve grant")
+	}
+
+	if err := h.slackService.NotifyApprovers(ctx, grant); err != nil {
+		log.Error().Err(err).Str("grant", grant.Name).Msg("Failed to notify approvers")
+	}
+
+	text := fmt.Sprintf("Requested `%s` in `%s` for %s, grant `%s` is *%s*",
+		entitlement, parent.Resource, duration, resourceID(grant.Name), grant.State.String())
+	if decision != nil {
+		text += fmt.Sprintf(" (%s)", decision.Reason)
+	}
+
+	h.reply(ctx, cmd.ResponseURL, text)
+}
+
+// reply sends text to the user behind a slash command or interaction through its response URL
+func (h *SlackHandler) reply(ctx context.Context, responseURL, text string) {
+	if err := h.slackService.RespondEphemeral(ctx, responseURL, text); err != nil {
+		log.Error().Err(err).Msg("Failed to respond to slack user")
+	}
+}
+
+// Interaction handles the Approve and Deny buttons on approval messages. The grant is approved or denied
+// as the Google identity of the Slack user who clicked, and the message is updated in place.
+func (h *SlackHandler) Interaction(c *gin.Context) {
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(c.PostForm("payload")), &callback); err != nil {
+		log.Error().Err(err).Msg("Failed to parse interaction payload")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interaction payload"})
+		return
+	}
+
+	if callback.Type != slack.InteractionTypeBlockActions || len(callback.ActionCallback.BlockActions) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	action := callback.ActionCallback.BlockActions[0]
+	if action.ActionID != services.ApproveGrantActionID && action.ActionID != services.DenyGrantActionID {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Status(http.StatusOK)
+
+	// Slack expects an answer within 3 seconds, so the grant is decided after answering
+	// and the result is shown by updating the message
+	ctx, cancel := context.WithTimeout(context.Background(), slackTimeout)
+	go func() {
+		defer cancel()
+		h.decideGrant(ctx, callback, action)
+	}()
+}
+
+// decideGrant approves or denies the grant of the approval message as the Slack user who clicked
+func (h *SlackHandler) decideGrant(ctx context.Context, callback slack.InteractionCallback, action *slack.BlockAction) {
+	parent, entitlement, id, err := services.ParseGrantName(action.Value)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid grant in interaction")
+		h.reply(ctx, callback.ResponseURL, "This approval message refers to an invalid grant")
+		return
+	}
+
+	if h.delegationServiceAccount == "" {
+		log.Error().Msg("SLACK_DELEGATION_SERVICE_ACCOUNT is not configured")
+		h.reply(ctx, callback.ResponseURL, "Approving grants from Slack is not configured")
+		return
+	}
+
+	principal, ok := h.authorize(ctx, callback.User.ID, callback.ResponseURL, rbac.Approver)
+	if !ok {
+		return
+	}
+	email := principal.Email
+
+	service, ok := h.delegatedService(ctx, email, callback.ResponseURL)
+	if !ok {
+		return
+	}
+	defer service.Close()
+
+	var grant *privilegedaccessmanagerpb.Grant
+	if action.ActionID == services.ApproveGrantActionID {
+		reason := fmt.Sprintf("Approved in Slack by %s", email)
+		if grant, err = service.ApproveGrant(ctx, parent, entitlement, id, reason); err == nil {
+			h.audit(principal, callback.User.ID, "grant.approve").Str("grant", grant.Name).Str("reason", reason).Msg("Approved grant")
+		}
+	} else {
+		reason := fmt.Sprintf("Denied in Slack by %s", email)
+		if grant, err = service.DenyGrant(ctx, parent, entitlement, id, reason); err == nil {
+			h.audit(principal, callback.User.ID, "grant.deny").Str("grant", grant.Name).Str("reason", reason).Msg("Denied grant")
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("email", email).Str("action", action.ActionID).Str("grant", parent.GrantName(entitlement, id)).Msg("Failed to act on grant")
+		h.reply(ctx, callback.ResponseURL, fmt.Sprintf("Failed to act on grant `%s`, it may already have been decided or you may not be an approver", id))
+		return
+	}
+
+	if err := h.slackService.UpdateApprovalMessage(ctx, callback.Channel.ID, callback.Message.Timestamp, callback.User.ID, grant); err != nil {
+		log.Error().Err(err).Str("grant", grant.Name).Msg("Failed to update approval message")
+	}
+}
+
+// authorize maps the Slack user to the principal of their Google identity through the email on their
+// Slack profile, and checks that they have the role. If either fails, the user is told and false is returned.
+func (h *SlackHandler) authorize(ctx context.Context, slackUser, responseURL string, role rbac.Role) (*models.Principal, bool) {
+	email, err := h.slackService.GetUserEmail(ctx, slackUser)
+	if err != nil {
+		log.Error().Err(err).Str("slack_user", slackUser).Msg("Failed to map slack user")
+		h.reply(ctx, responseURL, "Could not find the email address of your Slack account")
+		return nil, false
+	}
+
+	// Slack only sets confirmed email addresses on profiles, and the grant is requested or decided
+	// as that Google identity through domain-wide delegation
+	principal := &models.Principal{
+		Email:         email,
+		EmailVerified: true,
+		TokenType:     slackTokenType,
+	}
+
+	if h.groups != nil {
+		groups, err := h.groups.Groups(ctx, email)
+		if err != nil {
+			log.Error().Err(err).Str("user", email).Msg("Failed to look up groups")
+		}
+		principal.Groups = groups
+	}
+
+	if !h.roles.Has(principal, role) {
+		log.Warn().Str("role", string(role)).Str("user", email).Str("slack_user", slackUser).Msg("Slack user is missing role")
+		h.reply(ctx, responseURL, fmt.Sprintf("You need the %s role to do this", role))
+		return nil, false
+	}
+
+	return principal, true
+}
+
+// delegatedService creates a PAM service acting as the Google identity with the email, through
+// domain-wide delegation. If it fails, the user is told and false is returned.
+func (h *SlackHandler) delegatedService(ctx context.Context, email, responseURL string) (*services.PAMService, bool) {
+	tokenSource, err := services.DelegatedTokenSource(ctx, h.delegationServiceAccount, email)
+	if err != nil {
+		log.Error().Err(err).Str("email", email).Msg("Failed to create delegated token source")
+		h.reply(ctx, responseURL, "Failed to act on behalf of your Google account")
+		return nil, false
+	}
+
+	service, err := services.NewPAMService(ctx, tokenSource)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create PAM service")
+		h.reply(ctx, responseURL, "Failed to create PAM service")
+		return nil, false
+	}
+
+	return service, true
+}
+
+// audit starts an audit event for an action a Slack user took as their Google identity, through
+// domain-wide delegation on the delegation service account
+func (h *SlackHandler) audit(principal *models.Principal, slackUser, action string) *zerolog.Event {
+	return log.Info().
+		Str("audit", action).
+		Str("user", principal.Email).
+		Str("slack_user", slackUser).
+		Strs("groups", principal.Groups).
+		Str("token_type", slackTokenType).
+		Str("credentials", slackCredentials).
+		Str("service_account", h.delegationServiceAccount)
+}
+
+func ephemeral(text string) *slack.Msg {
+	return &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         text,
+	}
+}
+
+// parseDuration accepts Go durations such as 90m or 2h, or a plain number of seconds.
+func parseDuration(s string) (time.Duration, error) {
+	duration, err := time.ParseDuration(s)
+	if seconds, convErr := strconv.ParseInt(s, 10, 64); convErr == nil {
+		duration, err = time.Duration(seconds)*time.Second, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/models"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+)
+
+// policyBacktest replays historical grants through a candidate policy and reports the requests
+// it decides differently than the baseline policy. Grants come from an exported JSON file, or
+// are listed from PAM with the application default credentials.
+func policyBacktest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("policy backtest", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	candidateFile := flags.String("policy", "", "candidate policy file")
+	baselineFile := flags.String("baseline", os.Getenv("POLICY_FILE"), "baseline policy file, defaults to $POLICY_FILE, without one nothing is auto-approved")
+	grantsFile := flags.String("grants", "", "JSON file of exported grants, as returned by GET /pam/grants")
+	parent := flags.String("parent", "", "parent of the entitlement to list grants from, e.g. projects/my-project")
+	entitlement := flags.String("entitlement", "", "entitlement to list grants from")
+	filter := flags.String("filter", "", "filter for listing grants from PAM")
+	verbose := flags.Bool("v", false, "list every request that is decided differently")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *candidateFile == "" || (*grantsFile == "") == (*entitlement == "") {
+		fmt.Fprintln(stderr, "--policy and one of --grants or --parent and --entitlement are required")
+		flags.Usage()
+		return 2
+	}
+
+	candidate, err := policy.Load(*candidateFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid candidate policy %s: %v\n", *candidateFile, err)
+		return 1
+	}
+
+	var baseline *policy.Engine
+	if *baselineFile != "" {
+		if baseline, err = policy.Load(*baselineFile); err != nil {
+			fmt.Fprintf(stderr, "invalid baseline policy %s: %v\n", *baselineFile, err)
+			return 1
+		}
+	}
+
+	var requests map[string]policy.Request
+	if *grantsFile != "" {
+		requests, err = requestsFromFile(*grantsFile)
+	} else {
+		requests, err = requestsFromPAM(context.Background(), *parent, *entitlement, *filter)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load grants: %v\n", err)
+		return 1
+	}
+
+	backtest := policy.RunBacktest(baseline, candidate, requests)
+
+	fmt.Fprintf(stdout, "%d requests replayed, %d decided differently\n\n", backtest.Total, backtest.Changed)
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTITLEMENT\tTOTAL\tNEWLY APPROVED\tNEWLY MANUAL")
+	for _, d := range backtest.ByEntitlement {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", d.Key, d.Total, d.NewlyApproved, d.NewlyManual)
+	}
+	fmt.Fprintln(w, "\t\t\t")
+	fmt.Fprintln(w, "REQUESTER\tTOTAL\tNEWLY APPROVED\tNEWLY MANUAL")
+	for _, d := range backtest.ByRequester {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", d.Key, d.Total, d.NewlyApproved, d.NewlyManual)
+	}
+	w.Flush()
+
+	if *verbose && backtest.Changed > 0 {
+		fmt.Fprintln(stdout, "\nChanged decisions:")
+		for _, result := range backtest.ChangedResults {
+			fmt.Fprintf(stdout, "  %s (%s, %s): baseline approve=%t rule=%q, candidate approve=%t rule=%q\n",
+				result.ID, result.Request.Requester, result.Request.Time.Format(time.RFC3339),
+				result.Baseline.Approve, result.Baseline.Rule, result.Candidate.Approve, result.Candidate.Rule)
+		}
+	}
+
+	return 0
+}
+
+// requestsFromFile reads grants exported from GET /pam/grants, either the response
+// object or a plain list of grants. An object without grants is rejected, so a wrong
+// file is not reported as a policy without differences.
+func requestsFromFile(path string) (map[string]policy.Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var grants []models.Grant
+	var export struct {
+		Grants *[]models.Grant `json:"grants"`
+	}
+	if err := json.Unmarshal(data, &export); err == nil {
+		if export.Grants == nil {
+			return nil, errors.New("no grants field, expected the response of GET /pam/grants or a list of grants")
+		}
+		grants = *export.Grants
+	} else if err := json.Unmarshal(data, &grants); err != nil {
+		return nil, fmt.Errorf("failed to parse grants: %v", err)
+	}
+
+	requests := map[string]policy.Request{}
+	for _, grant := range grants {
+		parent, entitlement, _, err := services.ParseGrantName(grant.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		requests[grant.Name] = policy.Request{
+			Requester:     grant.Requester,
+			Parent:        parent.Resource,
+			Entitlement:   entitlement,
+			Duration:      time.Duration(grant.Duration) * time.Second,
+			Justification: grant.Justification,
+			Time:          grant.CreateTime,
+			Roles:         grant.Roles,
+		}
+	}
+
+	return requests, nil
+}
+
+// requestsFromPAM lists every grant of the entitlement
+func requestsFromPAM(ctx context.Context, resource, entitlement, filter string) (map[string]policy.Request, error) {
+	parent, err := services.ParseParent(resource, "")
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := services.NewPAMService(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer service.Close()
+
+	requests := map[string]policy.Request{}
+	opts := services.ListOptions{PageSize: 1000, Filter: filter}
+	for {
+		grants, nextPageToken, err := service.GetGrants(ctx, parent, entitlement, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, grant := range grants {
+			requests[grant.Name] = requestFromGrant(parent, entitlement, grant)
+		}
+
+		if nextPageToken == "" {
+			return requests, nil
+		}
+		opts.PageToken = nextPageToken
+	}
+}
+
+func requestFromGrant(parent services.Parent, entitlement string, grant *privilegedaccessmanagerpb.Grant) policy.Request {
+	req := policy.Request{
+		Requester:     grant.GetRequester(),
+		Parent:        parent.Resource,
+		Entitlement:   entitlement,
+		Duration:      grant.GetRequestedDuration().AsDuration(),
+		Justification: grant.GetJustification().GetUnstructuredJustification(),
+		Time:          grant.GetCreateTime().AsTime(),
+	}
+
+	for _, binding := range grant.GetPrivilegedAccess().GetGcpIamAccess().GetRoleBindings() {
+		req.Roles = append(req.Roles, binding.Role)
+	}
+
+	return req
+}
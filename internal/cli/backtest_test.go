@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGrant = `{
+	"id": "1",
+	"name": "projects/prod/locations/global/entitlements/prod-admin/grants/1",
+	"requester": "jane@example.com",
+	"duration": 3600,
+	"justification": "INC-1",
+	"state": "ENDED",
+	"roles": ["roles/cloudsql.admin"],
+	"create_time": "2024-10-21T23:00:00Z"
+}`
+
+func writeGrants(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "grants.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRequestsFromFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantCount int
+		wantErr   string
+	}{
+		{"response object", `{"grants": [` + testGrant + `], "next_page_token": ""}`, 1, ""},
+		{"list", `[` + testGrant + `]`, 1, ""},
+		{"empty list", `{"grants": []}`, 0, ""},
+		{"object without grants", `{"entitlements": [` + testGrant + `]}`, 0, "no grants field"},
+		{"null", `null`, 0, "no grants field"},
+		{"invalid JSON", `{"grants": [`, 0, "failed to parse grants"},
+		{"invalid grant name", `[{"name": "prod-admin/grants/1"}]`, 0, "invalid grant name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := requestsFromFile(writeGrants(t, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("requestsFromFile() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("requestsFromFile() error = %v", err)
+			}
+			if len(requests) != tt.wantCount {
+				t.Errorf("requestsFromFile() returned %d requests, want %d", len(requests), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRequestsFromFileFields(t *testing.T) {
+	requests, err := requestsFromFile(writeGrants(t, `[`+testGrant+`]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := requests["projects/prod/locations/global/entitlements/prod-admin/grants/1"]
+	if req.Requester != "jane@example.com" || req.Parent != "projects/prod" || req.Entitlement != "prod-admin" ||
+		req.Duration != time.Hour || req.Justification != "INC-1" || len(req.Roles) != 1 ||
+		!req.Time.Equal(time.Date(2024, time.October, 21, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("request = %+v", req)
+	}
+}
+
+func TestPolicyBacktest(t *testing.T) {
+	dir := t.TempDir()
+	baseline := filepath.Join(dir, "baseline.yaml")
+	candidate := filepath.Join(dir, "candidate.yaml")
+	if err := os.WriteFile(baseline, []byte("rules: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(candidate, []byte("rules:\n  - name: incidents\n    justification_pattern: ^INC-\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := Policy([]string{"backtest", "--policy", candidate, "--baseline", baseline, "--grants", writeGrants(t, `[`+testGrant+`]`), "-v"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+
+	for _, want := range []string{
+		"1 requests replayed, 1 decided differently",
+		"projects/prod/prod-admin  1      1               0",
+		`candidate approve=true rule="incidents"`,
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, stdout.String())
+		}
+	}
+}
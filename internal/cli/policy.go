@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+)
+
+const policyUsage = `Usage: pam-manager policy <command> [flags]
+
+Commands:
+  test      run policy test fixtures against a policy file
+  backtest  replay historical grants through a candidate policy file
+`
+
+// Policy runs the policy subcommands and returns the exit code
+func Policy(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, policyUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "test":
+		return policyTest(args[1:], stdout, stderr)
+	case "backtest":
+		return policyBacktest(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown policy command %q\n\n%s", args[0], policyUsage)
+		return 2
+	}
+}
+
+// policyTest runs a directory of test fixtures against the policy file, and fails
+// if any case gets a different decision than expected. It needs no GCP access.
+func policyTest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	policyFile := flags.String("policy", os.Getenv("POLICY_FILE"), "policy file to test, defaults to $POLICY_FILE")
+	dir := flags.String("dir", "policy_tests", "directory of test fixtures")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *policyFile == "" {
+		fmt.Fprintln(stderr, "a policy file is required, set --policy or POLICY_FILE")
+		return 2
+	}
+
+	engine, err := policy.Load(*policyFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid policy %s: %v\n", *policyFile, err)
+		return 1
+	}
+
+	results, err := policy.RunTests(engine, *dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to run tests: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		decision := result.Explanation.Decision
+
+		if result.Passed {
+			fmt.Fprintf(stdout, "PASS  %s (%s)\n", result.Case.Name, result.File)
+		} else {
+			failed++
+			fmt.Fprintf(stdout, "FAIL  %s (%s)\n", result.Case.Name, result.File)
+			fmt.Fprintf(stdout, "      expected approve=%t rule=%q, got approve=%t rule=%q\n",
+				result.Case.Expect.Approve, result.Case.Expect.Rule, decision.Approve, decision.Rule)
+		}
+
+		for _, rule := range result.Explanation.Rules {
+			if rule.Matched {
+				fmt.Fprintf(stdout, "      %s: matched\n", rule.Rule)
+				continue
+			}
+			for _, reason := range rule.Reasons {
+				fmt.Fprintf(stdout, "      %s: %s\n", rule.Rule, reason)
+			}
+		}
+	}
+
+	fmt.Fprintf(stdout, "\n%d passed, %d failed\n", len(results)-failed, failed)
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
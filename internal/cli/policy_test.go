@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+  - name: incidents
+    justification_pattern: ^INC-
+  - name: business-hours
+    hours: {start: "09:00", end: "17:00", timezone: Europe/Oslo}
+`
+
+// writeFixtures writes the policy and the test cases to temporary files, and returns the
+// policy file and the fixture directory
+func writeFixtures(t *testing.T, cases string) (string, string) {
+	t.Helper()
+
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyFile, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cases.yaml"), []byte(cases), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return policyFile, dir
+}
+
+func TestPolicyTest(t *testing.T) {
+	policyFile, dir := writeFixtures(t, `
+cases:
+  - name: incident at night
+    request: {requester: jane@example.com, justification: INC-1, time: 2024-10-21T23:00:00+02:00}
+    expect: {approve: true, rule: incidents}
+  - name: wrong expectation
+    request: {requester: jane@example.com, justification: debugging, time: 2024-10-21T10:00:00+02:00}
+    expect: {approve: false}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := Policy([]string{"test", "--policy", policyFile, "--dir", dir}, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1, stderr: %s", code, stderr.String())
+	}
+
+	// Every case is listed with its rule trace, whether it passed or not
+	for _, want := range []string{
+		"PASS  incident at night",
+		"      incidents: matched\n      business-hours: time 2024-10-21T23:00:00+02:00 is outside hours",
+		"FAIL  wrong expectation",
+		`      incidents: justification does not match "^INC-"` + "\n      business-hours: matched",
+		"1 passed, 1 failed",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestPolicyTestRequiresTime(t *testing.T) {
+	policyFile, dir := writeFixtures(t, `
+cases:
+  - name: no time
+    request: {requester: jane@example.com, justification: INC-1}
+    expect: {approve: true, rule: incidents}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := Policy([]string{"test", "--policy", policyFile, "--dir", dir}, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), `case "no time" needs a time`) {
+		t.Errorf("stderr = %q, want the case without a time reported", stderr.String())
+	}
+}
@@ -1,14 +1,44 @@
 package config
 
+import "time"
+
 // Config is the configuration for the application
 // It contains the port, debug, and host configuration
 type Config struct {
-	Port               string `envconfig:"PORT" default:"8080"`
-	Debug              bool   `envconfig:"DEBUG" default:"false"`
-	SlackClientSecret  string `envconfig:"SLACK_CLIENT_SECRET" required:"true"`
-	SlackSigningSecret string `envconfig:"SLACK_SIGNING_SECRET" required:"true"`
-	SlackToken         string `envconfig:"SLACK_BOT_TOKEN" required:"true"`
-	GoogleClientID     string `envconfig:"GOOGLE_CLIENT_ID" required:"true"`
-	GoogleClientSecret string `envconfig:"GOOGLE_CLIENT_SECRET" required:"true"`
-	GoogleRedirectURL  string `envconfig:"GOOGLE_REDIRECT_URL" required:"true"`
+	Port                          string            `envconfig:"PORT" default:"8080"`
+	Debug                         bool              `envconfig:"DEBUG" default:"false"`
+	SlackClientSecret             string            `envconfig:"SLACK_CLIENT_SECRET" required:"true"`
+	SlackSigningSecret            string            `envconfig:"SLACK_SIGNING_SECRET" required:"true"`
+	SlackToken                    string            `envconfig:"SLACK_BOT_TOKEN" required:"true"`
+	SlackDelegationServiceAccount string            `envconfig:"SLACK_DELEGATION_SERVICE_ACCOUNT"`
+	SlackApproverChannel          string            `envconfig:"SLACK_APPROVER_CHANNEL"`
+	GoogleClientID                string            `envconfig:"GOOGLE_CLIENT_ID" required:"true"`
+	GoogleClientSecret            string            `envconfig:"GOOGLE_CLIENT_SECRET" required:"true"`
+	GoogleRedirectURL             string            `envconfig:"GOOGLE_REDIRECT_URL" required:"true"`
+	GoogleAuthURL                 string            `envconfig:"GOOGLE_AUTH_URL" default:"https://accounts.google.com/o/oauth2/auth"`
+	GoogleTokenURL                string            `envconfig:"GOOGLE_TOKEN_URL" default:"https://oauth2.googleapis.com/token"`
+	GoogleRevokeURL               string            `envconfig:"GOOGLE_REVOKE_URL" default:"https://oauth2.googleapis.com/revoke"`
+	GoogleJWKSURL                 string            `envconfig:"GOOGLE_JWKS_URL" default:"https://www.googleapis.com/oauth2/v3/certs"`
+	AccessTokenClients            []string          `envconfig:"ACCESS_TOKEN_CLIENTS"`
+	IDTokenAudiences              []string          `envconfig:"ID_TOKEN_AUDIENCES"`
+	IAPAudience                   string            `envconfig:"IAP_AUDIENCE"`
+	IAPJWKSURL                    string            `envconfig:"IAP_JWKS_URL" default:"https://www.gstatic.com/iap/verify/public_key-jwk"`
+	AllowedHostedDomains          []string          `envconfig:"ALLOWED_HOSTED_DOMAINS"`
+	CloudIdentityGroups           bool              `envconfig:"CLOUD_IDENTITY_GROUPS" default:"false"`
+	TokenCacheSize                int               `envconfig:"TOKEN_CACHE_SIZE" default:"10000"`
+	TokenCacheTTL                 time.Duration     `envconfig:"TOKEN_CACHE_TTL" default:"5m"`
+	TokenCacheNegativeTTL         time.Duration     `envconfig:"TOKEN_CACHE_NEGATIVE_TTL" default:"30s"`
+	RoleAdmins                    []string          `envconfig:"ROLE_ADMINS"`
+	RoleApprovers                 []string          `envconfig:"ROLE_APPROVERS"`
+	RoleAuditors                  []string          `envconfig:"ROLE_AUDITORS"`
+	RoleRequesters                []string          `envconfig:"ROLE_REQUESTERS"`
+	Credentials                   map[string]string `envconfig:"CREDENTIALS"`
+	ImpersonateServiceAccount     string            `envconfig:"IMPERSONATE_SERVICE_ACCOUNT"`
+	CookieSecret                  string            `envconfig:"COOKIE_SECRET" required:"true"`
+	SessionTTL                    time.Duration     `envconfig:"SESSION_TTL" default:"12h"`
+	PolicyFile                    string            `envconfig:"POLICY_FILE"`
+	PolicyReloadInterval          time.Duration     `envconfig:"POLICY_RELOAD_INTERVAL" default:"30s"`
+	RevokeEntitlements            []string          `envconfig:"REVOKE_ENTITLEMENTS"`
+	RevokeInterval                time.Duration     `envconfig:"REVOKE_INTERVAL" default:"5m"`
+	RevokeWebhookURL              string            `envconfig:"REVOKE_WEBHOOK_URL"`
 }
@@ -0,0 +1,76 @@
+package cookie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer signs cookie values so they can be trusted when they come back. The cookie name is
+// part of the signature, so a value signed for one cookie is not accepted as another.
+type Signer struct {
+	secret []byte
+}
+
+// MinSecretLength is the minimum length of a signer's secret in bytes, the size of the HMAC-SHA256 key
+const MinSecretLength = 32
+
+// NewSigner creates a signer, the secret must be kept private and be at least MinSecretLength bytes
+func NewSigner(secret string) (*Signer, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("secret must be at least %d bytes, got %d", MinSecretLength, len(secret))
+	}
+
+	return &Signer{secret: []byte(secret)}, nil
+}
+
+// Encode signs the value of the named cookie, it is valid until expires
+func (s *Signer) Encode(name, value string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + s.sign(name, payload)
+}
+
+// Decode verifies the signature and expiry of the named cookie and returns its value
+func (s *Signer) Decode(name, encoded string, now time.Time) (string, error) {
+	i := strings.LastIndex(encoded, ".")
+	if i < 0 {
+		return "", errors.New("malformed cookie")
+	}
+	payload, signature := encoded[:i], encoded[i+1:]
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(name, payload))) {
+		return "", errors.New("invalid cookie signature")
+	}
+
+	value, expires, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", errors.New("malformed cookie")
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("malformed cookie expiry: %v", err)
+	}
+
+	if now.After(time.Unix(unix, 0)) {
+		return "", errors.New("cookie has expired")
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("malformed cookie value: %v", err)
+	}
+
+	return string(decoded), nil
+}
+
+func (s *Signer) sign(name, payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(name + "=" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package cookie
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSigner(t *testing.T, secret string) *Signer {
+	t.Helper()
+
+	signer, err := NewSigner(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func TestNewSigner(t *testing.T) {
+	if _, err := NewSigner("0123456789abcdef0123456789abcde"); err == nil {
+		t.Error("NewSigner() error = nil for a 31 byte secret")
+	}
+	if _, err := NewSigner(""); err == nil {
+		t.Error("NewSigner() error = nil for an empty secret")
+	}
+	if _, err := NewSigner("0123456789abcdef0123456789abcdef"); err != nil {
+		t.Errorf("NewSigner() error = %v for a 32 byte secret", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	signer := newSigner(t, "0123456789abcdef0123456789abcdef")
+	now := time.Now()
+	encoded := signer.Encode("state", "state verifier", now.Add(time.Minute))
+
+	value, err := signer.Decode("state", encoded, now)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if value != "state verifier" {
+		t.Errorf("Decode() = %q, want %q", value, "state verifier")
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	signer := newSigner(t, "0123456789abcdef0123456789abcdef")
+	now := time.Now()
+	encoded := signer.Encode("state", "state verifier", now.Add(time.Minute))
+
+	_, rest, _ := strings.Cut(encoded, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte("state other")) + "." + rest
+
+	tests := []struct {
+		name    string
+		signer  *Signer
+		cookie  string
+		encoded string
+		now     time.Time
+		wantErr string
+	}{
+		{"expired", signer, "state", encoded, now.Add(2 * time.Minute), "expired"},
+		{"tampered value", signer, "state", tampered, now, "signature"},
+		{"other cookie", signer, "session", encoded, now, "signature"},
+		{"other secret", newSigner(t, "another secret of at least 32 bytes"), "state", encoded, now, "signature"},
+		{"malformed", signer, "state", "garbage", now, "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.signer.Decode(tt.cookie, tt.encoded, tt.now)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
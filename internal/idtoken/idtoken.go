@@ -0,0 +1,89 @@
+package idtoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// GoogleIssuers are the issuers of Google ID tokens
+var GoogleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// IAPIssuers are the issuers of Identity-Aware Proxy assertions
+var IAPIssuers = []string{"https://cloud.google.com/iap"}
+
+// Claims are the claims of a Google ID token or IAP assertion. EmailVerified is nil when the token
+// has no email_verified claim, as IAP assertions.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	HostedDomain  string `json:"hd,omitempty"`
+}
+
+// Verifier verifies JWTs locally against the cached keys of a JWKS URL
+type Verifier struct {
+	keys          *keySet
+	issuers       []string
+	audiences     []string
+	hostedDomains []string
+	parser        *jwt.Parser
+}
+
+// NewVerifier creates a verifier accepting tokens from the issuers for any of the audiences.
+// If hostedDomains is not empty, the token's hd claim must be one of them.
+func NewVerifier(jwksURL string, issuers, audiences, hostedDomains []string) *Verifier {
+	return &Verifier{
+		keys:          &keySet{url: jwksURL, client: &http.Client{Timeout: 10 * time.Second}},
+		issuers:       issuers,
+		audiences:     audiences,
+		hostedDomains: hostedDomains,
+		parser:        jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256"})),
+	}
+}
+
+// Verify checks the token's signature, issuer, audience, expiry and hosted domain, and returns its claims.
+// Tokens whose email is not verified are rejected.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	if !claims.VerifyExpiresAt(time.Now(), true) {
+		return nil, errors.New("invalid token: missing expiry")
+	}
+
+	if !slices.ContainsFunc(v.issuers, func(issuer string) bool { return claims.VerifyIssuer(issuer, true) }) {
+		return nil, fmt.Errorf("invalid token: unexpected issuer %q", claims.Issuer)
+	}
+
+	if !slices.ContainsFunc(v.audiences, func(audience string) bool { return claims.VerifyAudience(audience, true) }) {
+		return nil, fmt.Errorf("invalid token: unexpected audience %q", claims.Audience)
+	}
+
+	if len(v.hostedDomains) > 0 && !slices.Contains(v.hostedDomains, claims.HostedDomain) {
+		return nil, fmt.Errorf("invalid token: hosted domain %q is not allowed", claims.HostedDomain)
+	}
+
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return nil, fmt.Errorf("invalid token: email %q is not verified", claims.Email)
+	}
+
+	return &claims, nil
+}
+
+// IsJWT reports whether the token looks like a JWT rather than an opaque access token
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
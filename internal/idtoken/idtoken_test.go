@@ -0,0 +1,229 @@
+package idtoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/idtoken/idtokentest"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testIssuer   = "https://accounts.google.com"
+	testAudience = "client-id"
+)
+
+func validClaims() Claims {
+	verified := true
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   "123",
+			Audience:  jwt.ClaimStrings{testAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		Email:         "jane@example.com",
+		EmailVerified: &verified,
+		HostedDomain:  "example.com",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	jwks := idtokentest.NewServer(t)
+	rsaKey := jwks.AddRSAKey(t, "rsa")
+	ecKey := jwks.AddECKey(t, "ec")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewVerifier(jwks.URL, GoogleIssuers, []string{testAudience}, []string{"example.com"})
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr string
+	}{
+		{
+			name:  "RS256",
+			token: func() string { return idtokentest.Sign(t, "rsa", rsaKey, validClaims()) },
+		},
+		{
+			name:  "ES256",
+			token: func() string { return idtokentest.Sign(t, "ec", ecKey, validClaims()) },
+		},
+		{
+			name:    "bad signature",
+			token:   func() string { return idtokentest.Sign(t, "rsa", otherKey, validClaims()) },
+			wantErr: "verification error",
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims.Audience = jwt.ClaimStrings{"other-client"}
+				return idtokentest.Sign(t, "rsa", rsaKey, claims)
+			},
+			wantErr: "unexpected audience",
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims.Issuer = "https://evil.example.com"
+				return idtokentest.Sign(t, "rsa", rsaKey, claims)
+			},
+			wantErr: "unexpected issuer",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return idtokentest.Sign(t, "rsa", rsaKey, claims)
+			},
+			wantErr: "expired",
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = nil
+				return idtokentest.Sign(t, "rsa", rsaKey, claims)
+			},
+			wantErr: "missing expiry",
+		},
+		{
+			name: "disallowed hosted domain",
+			token: func() string {
+				claims := validClaims()
+				claims.HostedDomain = "other.com"
+				return idtokentest.Sign(t, "rsa", rsaKey, claims)
+			},
+			wantErr: "hosted domain",
+		},
+		{
+			name: "unverified email",
+			token: func() string {
+				claims := validClaims()
+				verified := false
+				claims.EmailVerified = &verified
+				return idtokentest.Sign(t, "rsa", rsaKey, claims)
+			},
+			wantErr: "not verified",
+		},
+		{
+			name: "HS256",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+				token.Header["kid"] = "rsa"
+				signed, _ := token.SignedString([]byte("secret"))
+				return signed
+			},
+			wantErr: "signing method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if claims.Email != "jane@example.com" || claims.HostedDomain != "example.com" {
+					t.Errorf("Verify() claims = %+v", claims)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRefetchesUnknownKey(t *testing.T) {
+	jwks := idtokentest.NewServer(t)
+	oldKey := jwks.AddRSAKey(t, "old")
+
+	verifier := NewVerifier(jwks.URL, GoogleIssuers, []string{testAudience}, nil)
+
+	if _, err := verifier.Verify(context.Background(), idtokentest.Sign(t, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// Google rotates its keys, a token with a new key ID is fetched for, but only once per interval
+	newKey := jwks.AddRSAKey(t, "new")
+	token := idtokentest.Sign(t, "new", newKey, validClaims())
+
+	if _, err := verifier.Verify(context.Background(), token); err == nil || !strings.Contains(err.Error(), "unknown key ID") {
+		t.Fatalf("Verify() error = %v, want unknown key ID within the refresh interval", err)
+	}
+	if got := jwks.Requests(); got != 1 {
+		t.Fatalf("JWKS requests = %d, want 1", got)
+	}
+
+	verifier.keys.mu.Lock()
+	verifier.keys.fetched = time.Now().Add(-2 * minRefreshInterval)
+	verifier.keys.mu.Unlock()
+
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got := jwks.Requests(); got != 2 {
+		t.Errorf("JWKS requests = %d, want 2", got)
+	}
+
+	// Known keys are served from the cache
+	if _, err := verifier.Verify(context.Background(), idtokentest.Sign(t, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got := jwks.Requests(); got != 2 {
+		t.Errorf("JWKS requests = %d, want 2", got)
+	}
+}
+
+// TestVerifyConcurrent verifies tokens while the keys are being fetched, and is meant to be run with -race
+func TestVerifyConcurrent(t *testing.T) {
+	jwks := idtokentest.NewServer(t)
+	key := jwks.AddRSAKey(t, "rsa")
+	token := idtokentest.Sign(t, "rsa", key, validClaims())
+
+	verifier := NewVerifier(jwks.URL, GoogleIssuers, []string{testAudience}, nil)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := verifier.Verify(context.Background(), token); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMaxAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"public, max-age=600, must-revalidate": 600 * time.Second,
+		"no-cache":                             defaultKeysTTL,
+		"max-age=abc":                          defaultKeysTTL,
+		"":                                     defaultKeysTTL,
+	}
+
+	for header, want := range tests {
+		if got := maxAge(header); got != want {
+			t.Errorf("maxAge(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package idtokentest serves locally generated signing keys on a fake JWKS endpoint and signs
+// tokens with them, to test code verifying Google ID tokens without reaching Google.
+package idtokentest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Server is a fake JWKS endpoint serving the public keys of its signing keys
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     map[string]crypto.Signer
+	requests atomic.Int32
+}
+
+// NewServer starts a JWKS endpoint without keys, which is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{keys: map[string]crypto.Signer{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var set struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		for kid, key := range s.keys {
+			set.Keys = append(set.Keys, jwk(kid, key.Public()))
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// AddRSAKey generates an RSA key served with the key ID
+func (s *Server) AddRSAKey(t testing.TB, kid string) crypto.Signer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.add(kid, key)
+
+	return key
+}
+
+// AddECKey generates a P-256 key served with the key ID
+func (s *Server) AddECKey(t testing.TB, kid string) crypto.Signer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.add(kid, key)
+
+	return key
+}
+
+// Requests returns how often the keys were fetched
+func (s *Server) Requests() int {
+	return int(s.requests.Load())
+}
+
+func (s *Server) add(kid string, key crypto.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[kid] = key
+}
+
+// Sign signs the claims with the key and key ID, with RS256 for RSA keys and ES256 for EC keys
+func Sign(t testing.TB, kid string, key crypto.Signer, claims jwt.Claims) string {
+	t.Helper()
+
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func jwk(kid string, key crypto.PublicKey) map[string]string {
+	encode := func(b *big.Int) string { return base64.RawURLEncoding.EncodeToString(b.Bytes()) }
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "n": encode(k.N), "e": encode(big.NewInt(int64(k.E)))}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(k.X), "y": encode(k.Y)}
+	default:
+		panic("unsupported key type")
+	}
+}
@@ -0,0 +1,186 @@
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// defaultKeysTTL is how long keys are cached when the JWKS response has no max-age
+	defaultKeysTTL = time.Hour
+	// minRefreshInterval limits how often an unknown key ID triggers a refetch
+	minRefreshInterval = time.Minute
+)
+
+// keySet caches the public keys served at a JWKS URL. Keys are refetched when they expire, or
+// when a token is signed with an unknown key, as Google rotates its keys. Concurrent lookups share
+// one fetch, made without holding the lock so cached keys can still be read.
+type keySet struct {
+	url    string
+	client *http.Client
+	group  singleflight.Group
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	expires time.Time
+	fetched time.Time
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	} `json:"keys"`
+}
+
+// key returns the public key with the ID, fetching the key set if needed
+func (s *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	now := time.Now()
+	key, ok := s.keys[kid]
+	fresh := now.Before(s.expires)
+	recent := now.Sub(s.fetched) < minRefreshInterval
+	s.mu.Unlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if recent && fresh {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	// The fetch is shared, so it is not cancelled with the request that started it
+	_, err, _ := s.group.Do(s.url, func() (any, error) {
+		return nil, s.fetch(context.WithoutCancel(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	key, ok = s.keys[kid]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	return key, nil
+}
+
+func (s *keySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var set jwks
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		key, err := parseKey(k.Kty, k.N, k.E, k.Crv, k.X, k.Y)
+		if err != nil {
+			return fmt.Errorf("invalid JWKS key %q: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+	s.fetched = now
+	s.expires = now.Add(maxAge(resp.Header.Get("Cache-Control")))
+
+	return nil
+}
+
+func parseKey(kty, n, e, crv, x, y string) (crypto.PublicKey, error) {
+	switch kty {
+	case "RSA":
+		modulus, err := base64.RawURLEncoding.DecodeString(n)
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(e)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}, nil
+	case "EC":
+		if crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		xBytes, err := base64.RawURLEncoding.DecodeString(x)
+		if err != nil {
+			return nil, err
+		}
+		yBytes, err := base64.RawURLEncoding.DecodeString(y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", kty)
+	}
+}
+
+// maxAge returns the max-age of a Cache-Control header, or defaultKeysTTL
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name != "max-age" {
+			continue
+		}
+
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return defaultKeysTTL
+}
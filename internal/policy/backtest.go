@@ -0,0 +1,99 @@
+package policy
+
+import "sort"
+
+// Backtest is the result of replaying historical requests through a baseline
+// and a candidate policy
+type Backtest struct {
+	Total          int
+	Changed        int
+	ByEntitlement  []BacktestDelta
+	ByRequester    []BacktestDelta
+	ChangedResults []BacktestResult
+}
+
+// BacktestDelta counts the requests of one entitlement or requester that the candidate
+// newly approves, or newly leaves for manual approval, compared to the baseline
+type BacktestDelta struct {
+	Key           string
+	Total         int
+	NewlyApproved int
+	NewlyManual   int
+}
+
+// BacktestResult is a request along with the decisions of both policies
+type BacktestResult struct {
+	ID        string
+	Request   Request
+	Baseline  Decision
+	Candidate Decision
+}
+
+// RunBacktest evaluates every request against both policies, keyed by ID for the report.
+// A nil baseline approves nothing.
+func RunBacktest(baseline, candidate *Engine, requests map[string]Request) Backtest {
+	var backtest Backtest
+	byEntitlement := map[string]*BacktestDelta{}
+	byRequester := map[string]*BacktestDelta{}
+
+	ids := make([]string, 0, len(requests))
+	for id := range requests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		req := requests[id]
+		result := BacktestResult{
+			ID:        id,
+			Request:   req,
+			Baseline:  baseline.Evaluate(req),
+			Candidate: candidate.Evaluate(req),
+		}
+
+		backtest.Total++
+		entitlement := delta(byEntitlement, req.Parent+"/"+req.Entitlement)
+		requester := delta(byRequester, req.Requester)
+		entitlement.Total++
+		requester.Total++
+
+		if result.Baseline.Approve == result.Candidate.Approve {
+			continue
+		}
+
+		backtest.Changed++
+		backtest.ChangedResults = append(backtest.ChangedResults, result)
+		for _, d := range []*BacktestDelta{entitlement, requester} {
+			if result.Candidate.Approve {
+				d.NewlyApproved++
+			} else {
+				d.NewlyManual++
+			}
+		}
+	}
+
+	backtest.ByEntitlement = sortedDeltas(byEntitlement)
+	backtest.ByRequester = sortedDeltas(byRequester)
+
+	return backtest
+}
+
+func delta(deltas map[string]*BacktestDelta, key string) *BacktestDelta {
+	if d, ok := deltas[key]; ok {
+		return d
+	}
+
+	d := &BacktestDelta{Key: key}
+	deltas[key] = d
+	return d
+}
+
+func sortedDeltas(deltas map[string]*BacktestDelta) []BacktestDelta {
+	sorted := make([]BacktestDelta, 0, len(deltas))
+	for _, d := range deltas {
+		sorted = append(sorted, *d)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return sorted
+}
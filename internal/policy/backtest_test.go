@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunBacktest(t *testing.T) {
+	baseline, err := New([]Rule{{Name: "short", MaxDuration: Duration(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidate, err := New([]Rule{
+		{Name: "short-prod", MaxDuration: Duration(time.Hour), Parents: []string{"projects/prod"}},
+		{Name: "incidents", JustificationPattern: "^INC-"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := map[string]Request{
+		// Approved by both
+		"a": {Requester: "jane@example.com", Parent: "projects/prod", Entitlement: "admin", Duration: time.Hour},
+		// Newly manual, short but not in prod
+		"b": {Requester: "jane@example.com", Parent: "projects/dev", Entitlement: "admin", Duration: time.Hour},
+		// Newly approved, long but an incident
+		"c": {Requester: "john@example.com", Parent: "projects/prod", Entitlement: "admin", Duration: 4 * time.Hour, Justification: "INC-1"},
+		// Manual for both
+		"d": {Requester: "john@example.com", Parent: "projects/prod", Entitlement: "viewer", Duration: 4 * time.Hour},
+	}
+
+	backtest := RunBacktest(baseline, candidate, requests)
+
+	if backtest.Total != 4 || backtest.Changed != 2 {
+		t.Errorf("total = %d, changed = %d, want 4 and 2", backtest.Total, backtest.Changed)
+	}
+
+	if len(backtest.ChangedResults) != 2 || backtest.ChangedResults[0].ID != "b" || backtest.ChangedResults[1].ID != "c" {
+		t.Fatalf("changed results = %+v, want b and c", backtest.ChangedResults)
+	}
+	if c := backtest.ChangedResults[1]; c.Baseline.Approve || c.Candidate.Rule != "incidents" {
+		t.Errorf("result c = %+v, want newly approved by incidents", c)
+	}
+
+	wantEntitlements := []BacktestDelta{
+		{Key: "projects/dev/admin", Total: 1, NewlyManual: 1},
+		{Key: "projects/prod/admin", Total: 2, NewlyApproved: 1},
+		{Key: "projects/prod/viewer", Total: 1},
+	}
+	if !reflect.DeepEqual(backtest.ByEntitlement, wantEntitlements) {
+		t.Errorf("by entitlement = %+v, want %+v", backtest.ByEntitlement, wantEntitlements)
+	}
+
+	wantRequesters := []BacktestDelta{
+		{Key: "jane@example.com", Total: 2, NewlyManual: 1},
+		{Key: "john@example.com", Total: 2, NewlyApproved: 1},
+	}
+	if !reflect.DeepEqual(backtest.ByRequester, wantRequesters) {
+		t.Errorf("by requester = %+v, want %+v", backtest.ByRequester, wantRequesters)
+	}
+}
+
+func TestRunBacktestWithoutBaseline(t *testing.T) {
+	candidate, err := New([]Rule{{Name: "everyone", Domains: []string{"example.com"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backtest := RunBacktest(nil, candidate, map[string]Request{
+		"a": {Requester: "jane@example.com"},
+		"b": {Requester: "jane@example.org"},
+	})
+
+	if backtest.Total != 2 || backtest.Changed != 1 || backtest.ChangedResults[0].ID != "a" {
+		t.Errorf("backtest = %+v, want only a newly approved", backtest)
+	}
+}
+
+func TestRunBacktestEmpty(t *testing.T) {
+	backtest := RunBacktest(nil, nil, nil)
+	if backtest.Total != 0 || backtest.Changed != 0 || len(backtest.ByEntitlement) != 0 || len(backtest.ByRequester) != 0 {
+		t.Errorf("backtest = %+v, want empty", backtest)
+	}
+}
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+)
+
+// newEnv declares the request context available to rule expressions, named like
+// the request attributes of IAM conditions:
+//
+//	request.requester        string
+//	request.groups           list(string)
+//	request.parent           string, e.g. projects/my-project
+//	request.entitlement      string
+//	request.duration_seconds int
+//	request.justification    string
+//	request.time             timestamp
+//	request.roles            list(string)
+func newEnv() (*cel.Env, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("request.requester", cel.StringType),
+		cel.Variable("request.groups", cel.ListType(cel.StringType)),
+		cel.Variable("request.parent", cel.StringType),
+		cel.Variable("request.entitlement", cel.StringType),
+		cel.Variable("request.duration_seconds", cel.IntType),
+		cel.Variable("request.justification", cel.StringType),
+		cel.Variable("request.time", cel.TimestampType),
+		cel.Variable("request.roles", cel.ListType(cel.StringType)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create expression environment: %v", err)
+	}
+
+	return env, nil
+}
+
+// compileExpression parses and type-checks an expression, which must evaluate to a bool
+func compileExpression(env *cel.Env, expression string) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression: %v", issues.Err())
+	}
+
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("invalid expression: must evaluate to bool, not %s", ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %v", err)
+	}
+
+	return program, nil
+}
+
+func evalExpression(program cel.Program, req Request) (bool, error) {
+	groups, roles := req.Groups, req.Roles
+	if groups == nil {
+		groups = []string{}
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	out, _, err := program.Eval(map[string]any{
+		"request.requester":        req.Requester,
+		"request.groups":           groups,
+		"request.parent":           req.Parent,
+		"request.entitlement":      req.Entitlement,
+		"request.duration_seconds": int64(req.Duration.Seconds()),
+		"request.justification":    req.Justification,
+		"request.time":             req.Time,
+		"request.roles":            roles,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %T, not bool", out.Value())
+	}
+
+	return matched, nil
+}
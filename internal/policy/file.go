@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the policy file, written in YAML or JSON
+type File struct {
+	Rules       []Rule           `json:"rules"`
+	Revocations []RevocationRule `json:"revocations"`
+}
+
+// Parse parses a YAML or JSON policy file
+func Parse(data []byte) (*File, error) {
+	var file File
+	if err := decode(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %v", err)
+	}
+
+	return &file, nil
+}
+
+// Load reads the policy file at path and compiles its rules
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(file.Rules, file.Revocations...)
+}
+
+// decode decodes YAML or JSON into v. YAML is converted to JSON first,
+// so both formats use the JSON field names.
+func decode(data []byte, v any) error {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(v)
+}
@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TestCase is a policy test fixture: a request and the decision the policy is expected to make
+type TestCase struct {
+	Name    string      `json:"name"`
+	Request TestRequest `json:"request"`
+	Expect  Expectation `json:"expect"`
+}
+
+// TestRequest is a Request as written in fixtures. Time is required when the policy has rules
+// that depend on the time, so a case decides the same whenever it runs.
+type TestRequest struct {
+	Requester     string    `json:"requester"`
+	Groups        []string  `json:"groups,omitempty"`
+	Parent        string    `json:"parent"`
+	Entitlement   string    `json:"entitlement"`
+	Duration      Duration  `json:"duration"`
+	Justification string    `json:"justification"`
+	Time          time.Time `json:"time"`
+	Roles         []string  `json:"roles,omitempty"`
+}
+
+// Expectation is the expected decision, Rule is only checked when set
+type Expectation struct {
+	Approve bool   `json:"approve"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+// TestResult is the outcome of running a test case
+type TestResult struct {
+	Case        TestCase
+	File        string
+	Passed      bool
+	Explanation Explanation
+}
+
+type testFile struct {
+	Cases []TestCase `json:"cases"`
+}
+
+// Request converts the fixture request to a policy request
+func (r TestRequest) Request() Request {
+	return Request{
+		Requester:     r.Requester,
+		Groups:        r.Groups,
+		Parent:        r.Parent,
+		Entitlement:   r.Entitlement,
+		Duration:      time.Duration(r.Duration),
+		Justification: r.Justification,
+		Time:          r.Time,
+		Roles:         r.Roles,
+	}
+}
+
+// RunTests runs the test cases in every .yaml, .yml and .json file in dir against the engine.
+// Each file has a list of cases.
+func RunTests(engine *Engine, dir string) ([]TestResult, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no test files found in %s", dir)
+	}
+
+	var results []TestResult
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read test file: %v", err)
+		}
+
+		var cases testFile
+		if err := decode(data, &cases); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		for _, tc := range cases.Cases {
+			if tc.Request.Time.IsZero() && engine.dependsOnTime() {
+				return nil, fmt.Errorf("%s: case %q needs a time, the policy has rules that depend on the time", file, tc.Name)
+			}
+
+			explanation := engine.Explain(tc.Request.Request())
+			results = append(results, TestResult{
+				Case:        tc,
+				File:        file,
+				Passed:      tc.Expect.matches(explanation.Decision),
+				Explanation: explanation,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+func (e Expectation) matches(decision Decision) bool {
+	if e.Approve != decision.Approve {
+		return false
+	}
+
+	return e.Rule == "" || e.Rule == decision.Rule
+}
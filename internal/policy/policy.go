@@ -0,0 +1,369 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/rs/zerolog/log"
+)
+
+// Request is a grant request as seen by the policy engine
+type Request struct {
+	Requester     string
+	Groups        []string
+	Parent        string
+	Entitlement   string
+	Duration      time.Duration
+	Justification string
+	Time          time.Time
+	Roles         []string
+}
+
+// Rule auto-approves requests that match all of its conditions. Conditions that
+// are left out match any request, but a rule needs at least one condition.
+type Rule struct {
+	Name                 string   `json:"name"`
+	Requesters           []string `json:"requesters,omitempty"`
+	Domains              []string `json:"domains,omitempty"`
+	Parents              []string `json:"parents,omitempty"`
+	Entitlements         []string `json:"entitlements,omitempty"`
+	MaxDuration          Duration `json:"max_duration,omitempty"`
+	Hours                *Hours   `json:"hours,omitempty"`
+	JustificationPattern string   `json:"justification_pattern,omitempty"`
+	Expression           string   `json:"expression,omitempty"`
+}
+
+// Hours limits a rule to a daily time window, e.g. 09:00 to 17:00 on weekdays
+type Hours struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Timezone string   `json:"timezone,omitempty"`
+	Days     []string `json:"days,omitempty"`
+}
+
+// Duration is a time.Duration written as a Go duration string in JSON, e.g. "2h"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2h\": %v", err)
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Decision is the outcome of evaluating a request. Rule is the name of the
+// rule that approved the request.
+type Decision struct {
+	Approve bool   `json:"approve"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Engine evaluates requests against an ordered list of rules, the first matching rule approves.
+// It also holds the rules for revoking active grants.
+type Engine struct {
+	rules       []*rule
+	revocations []*revocationRule
+}
+
+type rule struct {
+	Rule
+	program       cel.Program
+	justification *regexp.Regexp
+	location      *time.Location
+	start, end    time.Duration
+	days          map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// New validates and compiles the rules into an engine, expressions are type-checked
+// so a bad rule fails here instead of when a request is evaluated
+func New(rules []Rule, revocations ...RevocationRule) (*Engine, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var engine Engine
+	var errs []error
+
+	names := map[string]bool{}
+	for i, r := range rules {
+		compiled, err := compile(env, r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %d (%s): %w", i, r.Name, err))
+			continue
+		}
+
+		if names[r.Name] {
+			errs = append(errs, fmt.Errorf("rule %d (%s): duplicate rule name", i, r.Name))
+			continue
+		}
+		names[r.Name] = true
+
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	for i, r := range revocations {
+		compiled, err := compileRevocation(env, r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("revocation %d (%s): %w", i, r.Name, err))
+			continue
+		}
+
+		engine.revocations = append(engine.revocations, compiled)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return &engine, nil
+}
+
+func compile(env *cel.Env, r Rule) (*rule, error) {
+	if r.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if len(r.Requesters) == 0 && len(r.Domains) == 0 && len(r.Parents) == 0 && len(r.Entitlements) == 0 &&
+		r.MaxDuration == 0 && r.Hours == nil && r.JustificationPattern == "" && r.Expression == "" {
+		return nil, errors.New("at least one condition is required")
+	}
+
+	compiled := &rule{Rule: r}
+
+	if r.Expression != "" {
+		program, err := compileExpression(env, r.Expression)
+		if err != nil {
+			return nil, err
+		}
+		compiled.program = program
+	}
+
+	if r.JustificationPattern != "" {
+		pattern, err := regexp.Compile(r.JustificationPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid justification_pattern: %v", err)
+		}
+		compiled.justification = pattern
+	}
+
+	if r.Hours != nil {
+		location, err := time.LoadLocation(r.Hours.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hours timezone: %v", err)
+		}
+		compiled.location = location
+
+		if compiled.start, err = parseClock(r.Hours.Start); err != nil {
+			return nil, fmt.Errorf("invalid hours start: %v", err)
+		}
+		if compiled.end, err = parseClock(r.Hours.End); err != nil {
+			return nil, fmt.Errorf("invalid hours end: %v", err)
+		}
+
+		if len(r.Hours.Days) > 0 {
+			compiled.days = map[time.Weekday]bool{}
+			for _, day := range r.Hours.Days {
+				weekday, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+				if !ok {
+					return nil, fmt.Errorf("invalid hours day: %q", day)
+				}
+				compiled.days[weekday] = true
+			}
+		}
+	}
+
+	return compiled, nil
+}
+
+// parseClock parses HH:MM into the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// RuleResult explains how a rule evaluated against a request. Reasons lists
+// the conditions that did not match.
+type RuleResult struct {
+	Rule    string   `json:"rule"`
+	Matched bool     `json:"matched"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Explanation is a decision along with how every rule evaluated
+type Explanation struct {
+	Decision Decision     `json:"decision"`
+	Rules    []RuleResult `json:"rules"`
+}
+
+// Evaluate returns the decision for the request, it is approved by the first matching rule.
+// A nil engine approves nothing.
+func (e *Engine) Evaluate(req Request) Decision {
+	if e == nil {
+		return notApproved()
+	}
+
+	for _, r := range e.rules {
+		if len(r.check(req)) == 0 {
+			return approved(r.Name)
+		}
+	}
+
+	return notApproved()
+}
+
+// Explain evaluates every rule against the request, and returns the decision Evaluate
+// would make along with why each rule did or did not match
+func (e *Engine) Explain(req Request) Explanation {
+	explanation := Explanation{
+		Decision: notApproved(),
+		Rules:    []RuleResult{},
+	}
+	if e == nil {
+		return explanation
+	}
+
+	for _, r := range e.rules {
+		reasons := r.check(req)
+		explanation.Rules = append(explanation.Rules, RuleResult{
+			Rule:    r.Name,
+			Matched: len(reasons) == 0,
+			Reasons: reasons,
+		})
+
+		if len(reasons) == 0 && !explanation.Decision.Approve {
+			explanation.Decision = approved(r.Name)
+		}
+	}
+
+	return explanation
+}
+
+// dependsOnTime reports whether any rule looks at the time of the request
+func (e *Engine) dependsOnTime() bool {
+	if e == nil {
+		return false
+	}
+
+	for _, r := range e.rules {
+		if r.Hours != nil || strings.Contains(r.Expression, "request.time") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func approved(rule string) Decision {
+	return Decision{
+		Approve: true,
+		Rule:    rule,
+		Reason:  fmt.Sprintf("matched rule %s", rule),
+	}
+}
+
+func notApproved() Decision {
+	return Decision{Reason: "no rule matched, manual approval required"}
+}
+
+// check returns the conditions of the rule that the request does not match
+func (r *rule) check(req Request) []string {
+	var reasons []string
+	requester := strings.ToLower(req.Requester)
+
+	if len(r.Requesters) > 0 && !containsFold(r.Requesters, requester) {
+		reasons = append(reasons, fmt.Sprintf("requester %q is not in requesters", req.Requester))
+	}
+
+	if len(r.Domains) > 0 {
+		_, domain, _ := strings.Cut(requester, "@")
+		if !containsFold(r.Domains, domain) {
+			reasons = append(reasons, fmt.Sprintf("requester domain %q is not in domains", domain))
+		}
+	}
+
+	if len(r.Parents) > 0 && !containsFold(r.Parents, req.Parent) {
+		reasons = append(reasons, fmt.Sprintf("parent %q is not in parents", req.Parent))
+	}
+
+	if len(r.Entitlements) > 0 && !containsFold(r.Entitlements, req.Entitlement) {
+		reasons = append(reasons, fmt.Sprintf("entitlement %q is not in entitlements", req.Entitlement))
+	}
+
+	if r.MaxDuration > 0 && req.Duration > time.Duration(r.MaxDuration) {
+		reasons = append(reasons, fmt.Sprintf("duration %s is longer than max_duration %s", req.Duration, time.Duration(r.MaxDuration)))
+	}
+
+	if r.justification != nil && !r.justification.MatchString(req.Justification) {
+		reasons = append(reasons, fmt.Sprintf("justification does not match %q", r.JustificationPattern))
+	}
+
+	if r.Hours != nil && !r.withinHours(req.Time) {
+		reasons = append(reasons, fmt.Sprintf("time %s is outside hours", req.Time.In(r.location).Format(time.RFC3339)))
+	}
+
+	if r.program != nil {
+		matched, err := evalExpression(r.program, req)
+		if err != nil {
+			log.Warn().Err(err).Str("rule", r.Name).Msg("Failed to evaluate policy expression")
+			reasons = append(reasons, fmt.Sprintf("expression failed to evaluate: %v", err))
+		} else if !matched {
+			reasons = append(reasons, "expression evaluated to false")
+		}
+	}
+
+	return reasons
+}
+
+// withinHours checks the time against the window, a window that ends before
+// it starts wraps around midnight
+func (r *rule) withinHours(t time.Time) bool {
+	local := t.In(r.location)
+	if r.days != nil && !r.days[local.Weekday()] {
+		return false
+	}
+
+	clock := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	if r.start <= r.end {
+		return clock >= r.start && clock < r.end
+	}
+
+	return clock >= r.start || clock < r.end
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,196 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// at returns the time on a day in June 2024 in UTC, the 3rd is a Monday
+func at(day int, clock string) time.Time {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		panic(err)
+	}
+
+	return time.Date(2024, time.June, day, t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func TestEvaluate(t *testing.T) {
+	request := Request{
+		Requester:     "Jane@Example.com",
+		Parent:        "projects/prod",
+		Entitlement:   "prod-admin",
+		Duration:      time.Hour,
+		Justification: "INC-1234 database failover",
+		Time:          at(3, "10:00"),
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		req     func(Request) Request
+		approve bool
+	}{
+		{"requester matches case-insensitively", Rule{Requesters: []string{"jane@example.com"}}, nil, true},
+		{"requester does not match", Rule{Requesters: []string{"john@example.com"}}, nil, false},
+		{"domain matches", Rule{Domains: []string{"example.com"}}, nil, true},
+		{"domain does not match", Rule{Domains: []string{"example.org"}}, nil, false},
+		{"parent matches", Rule{Parents: []string{"projects/prod"}}, nil, true},
+		{"parent does not match", Rule{Parents: []string{"projects/dev"}}, nil, false},
+		{"entitlement matches", Rule{Entitlements: []string{"prod-admin"}}, nil, true},
+		{"entitlement does not match", Rule{Entitlements: []string{"prod-viewer"}}, nil, false},
+		{"duration within max", Rule{MaxDuration: Duration(time.Hour)}, nil, true},
+		{"duration over max", Rule{MaxDuration: Duration(30 * time.Minute)}, nil, false},
+		{"justification matches", Rule{JustificationPattern: `^INC-\d+`}, nil, true},
+		{"justification does not match", Rule{JustificationPattern: `^CHG-\d+`}, nil, false},
+		{"expression true", Rule{Expression: `request.duration_seconds <= 7200`}, nil, true},
+		{"expression false", Rule{Expression: `request.entitlement == "prod-viewer"`}, nil, false},
+		{
+			name:    "all conditions must match",
+			rule:    Rule{Domains: []string{"example.com"}, Entitlements: []string{"prod-viewer"}},
+			approve: false,
+		},
+		{
+			name: "requester without a domain",
+			rule: Rule{Domains: []string{"example.com"}},
+			req: func(r Request) Request {
+				r.Requester = "jane"
+				return r
+			},
+			approve: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name = "rule"
+			engine, err := New([]Rule{tt.rule})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			req := request
+			if tt.req != nil {
+				req = tt.req(req)
+			}
+
+			decision := engine.Evaluate(req)
+			if decision.Approve != tt.approve {
+				t.Errorf("Evaluate() = %+v, want approve %v", decision, tt.approve)
+			}
+		})
+	}
+}
+
+func TestEvaluateHours(t *testing.T) {
+	tests := []struct {
+		name  string
+		hours Hours
+		time  time.Time
+		want  bool
+	}{
+		{"inside window", Hours{Start: "09:00", End: "17:00"}, at(3, "09:00"), true},
+		{"end is exclusive", Hours{Start: "09:00", End: "17:00"}, at(3, "17:00"), false},
+		{"before window", Hours{Start: "09:00", End: "17:00"}, at(3, "08:59"), false},
+		{"wrapping window before midnight", Hours{Start: "22:00", End: "06:00"}, at(3, "23:30"), true},
+		{"wrapping window after midnight", Hours{Start: "22:00", End: "06:00"}, at(3, "05:59"), true},
+		{"wrapping window during the day", Hours{Start: "22:00", End: "06:00"}, at(3, "12:00"), false},
+		{"wrapping window at its end", Hours{Start: "22:00", End: "06:00"}, at(3, "06:00"), false},
+		{"timezone", Hours{Start: "09:00", End: "17:00", Timezone: "Europe/Oslo"}, at(3, "07:30"), true},
+		{"timezone outside window", Hours{Start: "09:00", End: "17:00", Timezone: "Europe/Oslo"}, at(3, "15:30"), false},
+		{"weekday", Hours{Start: "00:00", End: "23:59", Days: []string{"mon", "wed"}}, at(5, "10:00"), true},
+		{"weekend", Hours{Start: "00:00", End: "23:59", Days: []string{"mon", "wed"}}, at(8, "10:00"), false},
+		{"full day names", Hours{Start: "00:00", End: "23:59", Days: []string{"Monday", "Saturday"}}, at(8, "10:00"), true},
+		// The day is that of the local time, not UTC
+		{"day in timezone", Hours{Start: "00:00", End: "23:59", Timezone: "Asia/Tokyo", Days: []string{"tue"}}, at(3, "20:00"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New([]Rule{{Name: "hours", Hours: &tt.hours}})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if got := engine.Evaluate(Request{Time: tt.time}).Approve; got != tt.want {
+				t.Errorf("Evaluate() at %s approve = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr string
+	}{
+		{"no name", []Rule{{Domains: []string{"example.com"}}}, "name is required"},
+		{"no conditions", []Rule{{Name: "empty"}}, "at least one condition"},
+		{"duplicate name", []Rule{{Name: "a", Domains: []string{"example.com"}}, {Name: "a", Domains: []string{"example.org"}}}, "duplicate rule name"},
+		{"invalid day", []Rule{{Name: "a", Hours: &Hours{Start: "09:00", End: "17:00", Days: []string{"funday"}}}}, "invalid hours day"},
+		{"empty day", []Rule{{Name: "a", Hours: &Hours{Start: "09:00", End: "17:00", Days: []string{""}}}}, "invalid hours day"},
+		{"invalid start", []Rule{{Name: "a", Hours: &Hours{Start: "9am", End: "17:00"}}}, "invalid hours start"},
+		{"invalid end", []Rule{{Name: "a", Hours: &Hours{Start: "09:00", End: "24:00"}}}, "invalid hours end"},
+		{"invalid timezone", []Rule{{Name: "a", Hours: &Hours{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus"}}}, "invalid hours timezone"},
+		{"invalid pattern", []Rule{{Name: "a", JustificationPattern: "("}}, "invalid justification_pattern"},
+		{"expression not a bool", []Rule{{Name: "a", Expression: `request.requester`}}, "must evaluate to bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.rules)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateFirstMatch(t *testing.T) {
+	engine, err := New([]Rule{
+		{Name: "viewers", Entitlements: []string{"prod-viewer"}},
+		{Name: "short", MaxDuration: Duration(time.Hour)},
+		{Name: "example", Domains: []string{"example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"first rule", Request{Requester: "jane@example.com", Entitlement: "prod-viewer", Duration: time.Hour}, "viewers"},
+		{"second rule before third", Request{Requester: "jane@example.com", Entitlement: "prod-admin", Duration: time.Hour}, "short"},
+		{"last rule", Request{Requester: "jane@example.com", Entitlement: "prod-admin", Duration: 2 * time.Hour}, "example"},
+		{"no rule", Request{Requester: "jane@example.org", Entitlement: "prod-admin", Duration: 2 * time.Hour}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := engine.Evaluate(tt.req)
+			if decision.Rule != tt.want || decision.Approve != (tt.want != "") {
+				t.Errorf("Evaluate() = %+v, want rule %q", decision, tt.want)
+			}
+
+			// Explain makes the same decision, and still evaluates the rules after the match
+			explanation := engine.Explain(tt.req)
+			if explanation.Decision != decision {
+				t.Errorf("Explain() decision = %+v, want %+v", explanation.Decision, decision)
+			}
+			if len(explanation.Rules) != 3 {
+				t.Errorf("Explain() evaluated %d rules, want 3", len(explanation.Rules))
+			}
+		})
+	}
+}
+
+func TestEvaluateNilEngine(t *testing.T) {
+	var engine *Engine
+	if decision := engine.Evaluate(Request{Requester: "jane@example.com"}); decision.Approve {
+		t.Errorf("Evaluate() = %+v, want no approval", decision)
+	}
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/rs/zerolog/log"
+)
+
+// RevocationRule revokes active grants that are in scope when its condition is met. Scope is
+// limited by parents and entitlements, and the condition is being outside hours or an expression
+// evaluating to true. Reason is recorded on the revoked grant.
+type RevocationRule struct {
+	Name         string   `json:"name"`
+	Parents      []string `json:"parents,omitempty"`
+	Entitlements []string `json:"entitlements,omitempty"`
+	OutsideHours *Hours   `json:"outside_hours,omitempty"`
+	Expression   string   `json:"expression,omitempty"`
+	Reason       string   `json:"reason"`
+}
+
+// Revocation is the outcome of checking an active grant against the revocation rules
+type Revocation struct {
+	Revoke bool
+	Rule   string
+	Reason string
+}
+
+type revocationRule struct {
+	RevocationRule
+	hours   *rule
+	program cel.Program
+}
+
+func compileRevocation(env *cel.Env, r RevocationRule) (*revocationRule, error) {
+	if r.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if r.Reason == "" {
+		return nil, errors.New("reason is required")
+	}
+
+	if r.OutsideHours == nil && r.Expression == "" {
+		return nil, errors.New("outside_hours or expression is required")
+	}
+
+	compiled := &revocationRule{RevocationRule: r}
+
+	if r.OutsideHours != nil {
+		hours, err := compile(env, Rule{Name: r.Name, Hours: r.OutsideHours})
+		if err != nil {
+			return nil, fmt.Errorf("invalid outside_hours: %w", err)
+		}
+		compiled.hours = hours
+	}
+
+	if r.Expression != "" {
+		program, err := compileExpression(env, r.Expression)
+		if err != nil {
+			return nil, err
+		}
+		compiled.program = program
+	}
+
+	return compiled, nil
+}
+
+// CheckRevocation returns whether the active grant described by req should be revoked, req.Time
+// is the time of the check. The first rule in scope whose condition is met revokes the grant.
+// A nil engine revokes nothing.
+func (e *Engine) CheckRevocation(req Request) Revocation {
+	if e == nil {
+		return Revocation{}
+	}
+
+	for _, r := range e.revocations {
+		if len(r.Parents) > 0 && !containsFold(r.Parents, req.Parent) {
+			continue
+		}
+
+		if len(r.Entitlements) > 0 && !containsFold(r.Entitlements, req.Entitlement) {
+			continue
+		}
+
+		if r.hours != nil && !r.hours.withinHours(req.Time) {
+			return Revocation{Revoke: true, Rule: r.Name, Reason: r.Reason}
+		}
+
+		if r.program != nil {
+			matched, err := evalExpression(r.program, req)
+			if err != nil {
+				log.Warn().Err(err).Str("rule", r.Name).Msg("Failed to evaluate revocation expression")
+				continue
+			}
+			if matched {
+				return Revocation{Revoke: true, Rule: r.Name, Reason: r.Reason}
+			}
+		}
+	}
+
+	return Revocation{}
+}
@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckRevocation(t *testing.T) {
+	engine, err := New(nil,
+		RevocationRule{
+			Name:         "prod-business-hours",
+			Parents:      []string{"projects/prod"},
+			Entitlements: []string{"prod-admin"},
+			OutsideHours: &Hours{Start: "08:00", End: "18:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}},
+			Reason:       "outside business hours",
+		},
+		RevocationRule{
+			Name:       "long-grants",
+			Expression: `request.duration_seconds > 7200`,
+			Reason:     "longer than two hours",
+		},
+		RevocationRule{
+			Name:       "no-incident",
+			Parents:    []string{"projects/prod"},
+			Expression: `!request.justification.startsWith("INC-")`,
+			Reason:     "not linked to an incident",
+		},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	request := Request{
+		Requester:     "jane@example.com",
+		Parent:        "projects/prod",
+		Entitlement:   "prod-admin",
+		Duration:      time.Hour,
+		Justification: "INC-1234",
+		Time:          at(3, "10:00"),
+	}
+
+	tests := []struct {
+		name     string
+		req      func(Request) Request
+		wantRule string
+	}{
+		{"within hours", nil, ""},
+		{
+			name: "outside hours",
+			req: func(r Request) Request {
+				r.Time = at(3, "19:00")
+				return r
+			},
+			wantRule: "prod-business-hours",
+		},
+		{
+			name: "weekend",
+			req: func(r Request) Request {
+				r.Time = at(8, "10:00")
+				return r
+			},
+			wantRule: "prod-business-hours",
+		},
+		{
+			name: "outside hours for another entitlement",
+			req: func(r Request) Request {
+				r.Entitlement = "prod-viewer"
+				r.Time = at(3, "19:00")
+				return r
+			},
+			wantRule: "",
+		},
+		{
+			name: "outside hours in another parent",
+			req: func(r Request) Request {
+				r.Parent = "projects/dev"
+				r.Time = at(3, "19:00")
+				return r
+			},
+			wantRule: "",
+		},
+		{
+			name: "expression",
+			req: func(r Request) Request {
+				r.Duration = 3 * time.Hour
+				return r
+			},
+			wantRule: "long-grants",
+		},
+		{
+			name: "first rule in scope wins",
+			req: func(r Request) Request {
+				r.Duration = 3 * time.Hour
+				r.Time = at(3, "19:00")
+				return r
+			},
+			wantRule: "prod-business-hours",
+		},
+		{
+			name: "expression scoped to parent",
+			req: func(r Request) Request {
+				r.Justification = "debugging"
+				return r
+			},
+			wantRule: "no-incident",
+		},
+		{
+			name: "expression out of scope",
+			req: func(r Request) Request {
+				r.Parent = "projects/dev"
+				r.Justification = "debugging"
+				return r
+			},
+			wantRule: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request
+			if tt.req != nil {
+				req = tt.req(req)
+			}
+
+			revocation := engine.CheckRevocation(req)
+			if revocation.Rule != tt.wantRule || revocation.Revoke != (tt.wantRule != "") {
+				t.Fatalf("CheckRevocation() = %+v, want rule %q", revocation, tt.wantRule)
+			}
+			if revocation.Revoke && revocation.Reason == "" {
+				t.Error("CheckRevocation() revoked without a reason")
+			}
+		})
+	}
+}
+
+func TestCheckRevocationNilEngine(t *testing.T) {
+	var engine *Engine
+	if revocation := engine.CheckRevocation(Request{}); revocation.Revoke {
+		t.Errorf("CheckRevocation() = %+v, want no revocation", revocation)
+	}
+}
+
+func TestNewRejectsRevocations(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RevocationRule
+		wantErr string
+	}{
+		{"no name", RevocationRule{Expression: "true", Reason: "reason"}, "name is required"},
+		{"no reason", RevocationRule{Name: "a", Expression: "true"}, "reason is required"},
+		{"no condition", RevocationRule{Name: "a", Reason: "reason"}, "outside_hours or expression is required"},
+		{"invalid hours", RevocationRule{Name: "a", OutsideHours: &Hours{Start: "8", End: "18:00"}, Reason: "reason"}, "invalid outside_hours"},
+		{"invalid expression", RevocationRule{Name: "a", Expression: "request.unknown", Reason: "reason"}, "invalid expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(nil, tt.rule)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Store holds the engine of the current policy file and reloads it when the file
+// changes or on SIGHUP. A reload that fails keeps the previous engine.
+type Store struct {
+	path   string
+	engine atomic.Pointer[Engine]
+	hash   []byte
+}
+
+// NewStore loads the policy file, it fails if the initial policy is invalid
+func NewStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Engine returns the current engine, or nil for a nil store
+func (s *Store) Engine() *Engine {
+	if s == nil {
+		return nil
+	}
+
+	return s.engine.Load()
+}
+
+// Watch reloads the policy file on SIGHUP, and when its content changes as checked every
+// interval, until the context is done. Watch must not be called more than once.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			s.reload()
+		case <-ticker.C:
+			if s.changed() {
+				s.reload()
+			}
+		}
+	}
+}
+
+// load reads the policy file and swaps in the new engine if it is valid. The hash of the
+// content is kept either way, so an invalid file is only reported once.
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	hash := sha256.Sum256(data)
+	s.hash = hash[:]
+
+	file, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	engine, err := New(file.Rules, file.Revocations...)
+	if err != nil {
+		return err
+	}
+
+	s.engine.Store(engine)
+	log.Info().Str("path", s.path).Int("rules", len(engine.rules)).Int("revocations", len(engine.revocations)).Msg("Loaded policy file")
+
+	return nil
+}
+
+func (s *Store) changed() bool {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("Failed to read policy file")
+		return false
+	}
+
+	hash := sha256.Sum256(data)
+	return !bytes.Equal(hash[:], s.hash)
+}
+
+func (s *Store) reload() {
+	if err := s.load(); err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("Failed to reload policy file, keeping the previous policy")
+	}
+}
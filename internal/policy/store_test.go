@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writePolicy replaces the policy file in one step, so the store never reads half a file
+func writePolicy(t *testing.T, path, content string) {
+	t.Helper()
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rulePolicy(name string) string {
+	return fmt.Sprintf("rules:\n  - name: %s\n    domains: [example.com]\n", name)
+}
+
+// ruleName returns the name of the first rule of the store's current engine
+func ruleName(s *Store) string {
+	engine := s.Engine()
+	if engine == nil || len(engine.rules) == 0 {
+		return ""
+	}
+
+	return engine.rules[0].Name
+}
+
+// waitForRule waits until the store's engine has the rule, calling poke while waiting
+func waitForRule(t *testing.T, s *Store, name string, poke func()) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ruleName(s) != name {
+		if time.Now().After(deadline) {
+			t.Fatalf("rule = %q, want %q", ruleName(s), name)
+		}
+		if poke != nil {
+			poke()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"valid change", rulePolicy("second"), "second"},
+		{"parse error keeps the previous engine", "rules: [", "first"},
+		{"invalid rule keeps the previous engine", "rules:\n  - name: empty\n", "first"},
+		{"invalid expression keeps the previous engine", "rules:\n  - name: bad\n    expression: request.requester\n", "first"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			writePolicy(t, path, rulePolicy("first"))
+
+			store, err := NewStore(path)
+			if err != nil {
+				t.Fatalf("NewStore() error = %v", err)
+			}
+
+			writePolicy(t, path, tt.content)
+			if !store.changed() {
+				t.Fatal("changed() = false after the file changed")
+			}
+			store.reload()
+
+			if got := ruleName(store); got != tt.want {
+				t.Errorf("rule = %q, want %q", got, tt.want)
+			}
+			// A failed reload is not retried until the file changes again
+			if store.changed() {
+				t.Error("changed() = true for a file that was already loaded")
+			}
+		})
+	}
+}
+
+func TestNewStoreRejectsInvalidPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, "rules: [")
+
+	if _, err := NewStore(path); err == nil {
+		t.Error("NewStore() error = nil for an invalid policy")
+	}
+	if _, err := NewStore(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("NewStore() error = nil for a missing file")
+	}
+}
+
+func TestStoreWatchInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, rulePolicy("first"))
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, 10*time.Millisecond)
+
+	writePolicy(t, path, rulePolicy("second"))
+	waitForRule(t, store, "second", nil)
+
+	writePolicy(t, path, "rules: [")
+	time.Sleep(50 * time.Millisecond)
+	if got := ruleName(store); got != "second" {
+		t.Errorf("rule = %q after an invalid change, want %q", got, "second")
+	}
+
+	writePolicy(t, path, rulePolicy("third"))
+	waitForRule(t, store, "third", nil)
+}
+
+func TestStoreWatchSIGHUP(t *testing.T) {
+	// Keep SIGHUP from stopping the test binary before Watch listens for it
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, rulePolicy("first"))
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The interval is too long to pick up the change, only SIGHUP reloads
+	go store.Watch(ctx, time.Hour)
+
+	writePolicy(t, path, rulePolicy("second"))
+	waitForRule(t, store, "second", func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// TestStoreWatchConcurrent reloads on SIGHUP and on the interval while requests read the engine,
+// and is meant to be run with -race
+func TestStoreWatchConcurrent(t *testing.T) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	writePolicy(t, path, rulePolicy("rule-0"))
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				store.Engine().Evaluate(Request{Requester: "jane@example.com"})
+			}
+		}()
+	}
+
+	for i := 1; i <= 20; i++ {
+		writePolicy(t, path, rulePolicy(fmt.Sprintf("rule-%d", i)))
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	waitForRule(t, store, "rule-20", nil)
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+package rbac
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/thoughtgears/pam-manager/models"
+)
+
+// Role is a role in pam-manager's own API, separate from the IAM roles PAM grants
+type Role string
+
+const (
+	// Requester can request grants and see their own grants and entitlements
+	Requester Role = "requester"
+	// Approver can approve and deny grants
+	Approver Role = "approver"
+	// Auditor can list all grants and look up operations
+	Auditor Role = "auditor"
+	// Admin can do everything, including revoking grants and managing entitlements
+	Admin Role = "admin"
+)
+
+// AllAuthenticatedUsers is the member matching every authenticated caller
+const AllAuthenticatedUsers = "allAuthenticatedUsers"
+
+// Policy binds roles to members, written like IAM members: user:{email}, group:{email},
+// domain:{domain} or allAuthenticatedUsers. Users only match with a verified email, and domains
+// only match the verified hosted domain of an ID token, IAP assertion or session, never the email.
+type Policy struct {
+	bindings map[Role][]string
+}
+
+// New validates the members bound to each role
+func New(bindings map[Role][]string) (*Policy, error) {
+	policy := &Policy{bindings: map[Role][]string{}}
+
+	for role, members := range bindings {
+		for _, member := range members {
+			kind, value, _ := strings.Cut(member, ":")
+			switch {
+			case member == AllAuthenticatedUsers:
+			case (kind == "user" || kind == "group" || kind == "domain") && value != "":
+			default:
+				return nil, fmt.Errorf("invalid member %q for role %s, must be user:, group:, domain: or %s", member, role, AllAuthenticatedUsers)
+			}
+
+			policy.bindings[role] = append(policy.bindings[role], strings.ToLower(member))
+		}
+	}
+
+	return policy, nil
+}
+
+// Has reports whether the principal has the role, admins have every role
+func (p *Policy) Has(principal *models.Principal, role Role) bool {
+	if principal == nil {
+		return false
+	}
+
+	return p.matches(principal, role) || (role != Admin && p.matches(principal, Admin))
+}
+
+func (p *Policy) matches(principal *models.Principal, role Role) bool {
+	var email string
+	if principal.EmailVerified {
+		email = strings.ToLower(principal.Email)
+	}
+	domain := strings.ToLower(principal.HostedDomain)
+
+	for _, member := range p.bindings[role] {
+		kind, value, _ := strings.Cut(member, ":")
+		switch {
+		case member == strings.ToLower(AllAuthenticatedUsers):
+			return true
+		case kind == "user" && email != "" && value == email:
+			return true
+		case kind == "domain" && domain != "" && value == domain:
+			return true
+		// Groups are only looked up for verified emails
+		case kind == "group" && slices.ContainsFunc(principal.Groups, func(group string) bool { return strings.EqualFold(group, value) }):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,52 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/thoughtgears/pam-manager/models"
+)
+
+func TestPolicyHas(t *testing.T) {
+	policy, err := New(map[Role][]string{
+		Admin:     {"user:Admin@example.com"},
+		Approver:  {"group:approvers@example.com"},
+		Auditor:   {"domain:audit.example.com"},
+		Requester: {"allAuthenticatedUsers"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		role      Role
+		want      bool
+	}{
+		{"verified user", &models.Principal{Email: "admin@example.com", EmailVerified: true}, Admin, true},
+		{"unverified user", &models.Principal{Email: "admin@example.com"}, Admin, false},
+		{"admin has every role", &models.Principal{Email: "admin@example.com", EmailVerified: true}, Auditor, true},
+		{"group", &models.Principal{Email: "a@example.com", EmailVerified: true, Groups: []string{"Approvers@example.com"}}, Approver, true},
+		{"not in group", &models.Principal{Email: "a@example.com", EmailVerified: true}, Approver, false},
+		{"hosted domain", &models.Principal{Email: "a@audit.example.com", HostedDomain: "audit.example.com"}, Auditor, true},
+		{"email domain without hosted domain", &models.Principal{Email: "a@audit.example.com", EmailVerified: true}, Auditor, false},
+		{"all authenticated users", &models.Principal{}, Requester, true},
+		{"no principal", nil, Requester, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Has(tt.principal, tt.role); got != tt.want {
+				t.Errorf("Has() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidMembers(t *testing.T) {
+	for _, member := range []string{"admin@example.com", "user:", "serviceAccount:sa@example.com"} {
+		if _, err := New(map[Role][]string{Admin: {member}}); err == nil {
+			t.Errorf("New() accepted member %q", member)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package revoker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// activeFilter lists the grants that currently hold access
+const activeFilter = `state = "ACTIVE"`
+
+// GrantService lists and revokes grants, it is implemented by services.PAMService
+type GrantService interface {
+	GetGrants(ctx context.Context, parent services.Parent, entitlement string, opts services.ListOptions) ([]*privilegedaccessmanagerpb.Grant, string, error)
+	RevokeGrant(ctx context.Context, parent services.Parent, entitlement, id, reason string) (*privilegedaccessmanagerpb.Grant, error)
+}
+
+// Worker periodically lists the active grants of a set of entitlements and revokes the ones whose
+// revocation condition is met, either a revocation rule in the policy file or the webhook.
+type Worker struct {
+	entitlements []string
+	policy       *policy.Store
+	webhookURL   string
+	credentials  *services.Credentials
+	client       *http.Client
+}
+
+// New creates a worker for the entitlements, given as full entitlement names. Either policyStore
+// or webhookURL may be left out. Grants are revoked with the credentials configured for
+// grant.auto_revoke.
+func New(entitlements []string, policyStore *policy.Store, webhookURL string, credentials *services.Credentials) *Worker {
+	return &Worker{
+		entitlements: entitlements,
+		policy:       policyStore,
+		webhookURL:   webhookURL,
+		credentials:  credentials,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run sweeps the entitlements every interval until the context is done. One PAM client is used
+// for all sweeps, and closed when the context is done.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	service, err := services.NewPAMService(ctx, w.credentials.TokenSource(w.credentials.Mode(services.OperationGrantAutoRevoke)))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create PAM service, grants will not be revoked")
+		return
+	}
+	defer service.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Sweep(ctx, service)
+		}
+	}
+}
+
+// Sweep checks the active grants of every entitlement once with the service. Errors are logged so
+// that one failing entitlement or grant does not stop the rest.
+func (w *Worker) Sweep(ctx context.Context, service GrantService) {
+	for _, name := range w.entitlements {
+		parent, entitlement, err := services.ParseEntitlementName(name)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to parse entitlement to revoke from")
+			continue
+		}
+
+		if err := w.sweepEntitlement(ctx, service, parent, entitlement); err != nil {
+			log.Error().Err(err).Str("entitlement", name).Msg("Failed to check active grants")
+		}
+	}
+}
+
+func (w *Worker) sweepEntitlement(ctx context.Context, service GrantService, parent services.Parent, entitlement string) error {
+	opts := services.ListOptions{PageSize: 1000, Filter: activeFilter}
+	for {
+		grants, nextPageToken, err := service.GetGrants(ctx, parent, entitlement, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, grant := range grants {
+			// Only grants holding access are revoked, whatever the filter returned
+			if grant.GetState() != privilegedaccessmanagerpb.Grant_ACTIVE {
+				continue
+			}
+
+			revocation, err := w.check(ctx, parent, entitlement, grant)
+			if err != nil {
+				log.Error().Err(err).Str("grant", grant.Name).Msg("Failed to check revocation condition")
+				continue
+			}
+
+			if !revocation.Revoke {
+				continue
+			}
+
+			id := grant.Name[strings.LastIndex(grant.Name, "/")+1:]
+			reason := fmt.Sprintf("Automatically revoked by %s: %s", revocation.Rule, revocation.Reason)
+			if _, err := service.RevokeGrant(ctx, parent, entitlement, id, reason); err != nil {
+				log.Error().Err(err).Str("grant", grant.Name).Msg("Failed to revoke grant")
+				continue
+			}
+
+			w.audit().
+				Str("grant", grant.Name).
+				Str("requester", grant.GetRequester()).
+				Str("rule", revocation.Rule).
+				Str("reason", reason).
+				Msg("Revoked grant")
+		}
+
+		if nextPageToken == "" {
+			return nil
+		}
+		opts.PageToken = nextPageToken
+	}
+}
+
+// audit starts an audit event for a revocation, with the credentials PAM was called with
+func (w *Worker) audit() *zerolog.Event {
+	mode := w.credentials.Mode(services.OperationGrantAutoRevoke)
+	event := log.Info().
+		Str("audit", services.OperationGrantAutoRevoke).
+		Str("credentials", string(mode))
+	if mode == services.CredentialsImpersonate {
+		event = event.Str("service_account", w.credentials.ServiceAccount())
+	}
+
+	return event
+}
+
+// check returns whether the grant should be revoked, revocation rules are checked before the webhook
+func (w *Worker) check(ctx context.Context, parent services.Parent, entitlement string, grant *privilegedaccessmanagerpb.Grant) (policy.Revocation, error) {
+	req := policy.Request{
+		Requester:     grant.GetRequester(),
+		Parent:        parent.Resource,
+		Entitlement:   entitlement,
+		Duration:      grant.GetRequestedDuration().AsDuration(),
+		Justification: grant.GetJustification().GetUnstructuredJustification(),
+		Time:          time.Now(),
+	}
+	for _, binding := range grant.GetPrivilegedAccess().GetGcpIamAccess().GetRoleBindings() {
+		req.Roles = append(req.Roles, binding.Role)
+	}
+
+	if revocation := w.policy.Engine().CheckRevocation(req); revocation.Revoke {
+		return revocation, nil
+	}
+
+	if w.webhookURL == "" {
+		return policy.Revocation{}, nil
+	}
+
+	return w.checkWebhook(ctx, grant, req)
+}
+
+// webhookRequest is posted to the webhook for every active grant
+type webhookRequest struct {
+	Grant         string    `json:"grant"`
+	Requester     string    `json:"requester"`
+	Parent        string    `json:"parent"`
+	Entitlement   string    `json:"entitlement"`
+	Roles         []string  `json:"roles"`
+	Justification string    `json:"justification"`
+	CreateTime    time.Time `json:"create_time"`
+	Duration      int64     `json:"duration"`
+}
+
+// webhookResponse is the webhook's answer, Reason is required when Revoke is true
+type webhookResponse struct {
+	Revoke bool   `json:"revoke"`
+	Reason string `json:"reason"`
+}
+
+// checkWebhook asks the webhook whether the grant should be revoked. This is where conditions
+// that live in other systems are checked, such as a linked incident being closed or the
+// requester having left the on-call rotation.
+func (w *Worker) checkWebhook(ctx context.Context, grant *privilegedaccessmanagerpb.Grant, req policy.Request) (policy.Revocation, error) {
+	body, err := json.Marshal(webhookRequest{
+		Grant:         grant.Name,
+		Requester:     req.Requester,
+		Parent:        req.Parent,
+		Entitlement:   req.Entitlement,
+		Roles:         req.Roles,
+		Justification: req.Justification,
+		CreateTime:    grant.GetCreateTime().AsTime(),
+		Duration:      int64(req.Duration.Seconds()),
+	})
+	if err != nil {
+		return policy.Revocation{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return policy.Revocation{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return policy.Revocation{}, fmt.Errorf("failed to call revocation webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return policy.Revocation{}, fmt.Errorf("revocation webhook returned %s", resp.Status)
+	}
+
+	var answer webhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return policy.Revocation{}, fmt.Errorf("failed to decode revocation webhook response: %v", err)
+	}
+
+	if answer.Revoke && answer.Reason == "" {
+		return policy.Revocation{}, errors.New("revocation webhook did not give a reason")
+	}
+
+	return policy.Revocation{Revoke: answer.Revoke, Rule: "webhook", Reason: answer.Reason}, nil
+}
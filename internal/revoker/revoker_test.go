@@ -0,0 +1,210 @@
+package revoker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/services"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const testEntitlement = "projects/prod/locations/global/entitlements/prod-admin"
+
+// fakePAM serves grants in pages of two and records what was revoked
+type fakePAM struct {
+	mu      sync.Mutex
+	grants  []*privilegedaccessmanagerpb.Grant
+	filters []string
+	revoked map[string]string
+}
+
+func (f *fakePAM) GetGrants(_ context.Context, parent services.Parent, entitlement string, opts services.ListOptions) ([]*privilegedaccessmanagerpb.Grant, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.filters = append(f.filters, opts.Filter)
+
+	start := 0
+	if opts.PageToken != "" {
+		start = int(opts.PageToken[0] - '0')
+	}
+	end := min(start+2, len(f.grants))
+
+	next := ""
+	if end < len(f.grants) {
+		next = string(rune('0' + end))
+	}
+
+	return f.grants[start:end], next, nil
+}
+
+func (f *fakePAM) RevokeGrant(_ context.Context, parent services.Parent, entitlement, id, reason string) (*privilegedaccessmanagerpb.Grant, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revoked[parent.GrantName(entitlement, id)] = reason
+	return &privilegedaccessmanagerpb.Grant{Name: parent.GrantName(entitlement, id), State: privilegedaccessmanagerpb.Grant_REVOKED}, nil
+}
+
+func grant(id, requester, justification string, state privilegedaccessmanagerpb.Grant_State) *privilegedaccessmanagerpb.Grant {
+	return &privilegedaccessmanagerpb.Grant{
+		Name:              testEntitlement + "/grants/" + id,
+		Requester:         requester,
+		State:             state,
+		RequestedDuration: durationpb.New(time.Hour),
+		CreateTime:        timestamppb.New(time.Date(2024, time.June, 3, 10, 0, 0, 0, time.UTC)),
+		Justification: &privilegedaccessmanagerpb.Justification{
+			Justification: &privilegedaccessmanagerpb.Justification_UnstructuredJustification{UnstructuredJustification: justification},
+		},
+		PrivilegedAccess: &privilegedaccessmanagerpb.PrivilegedAccess{
+			AccessType: &privilegedaccessmanagerpb.PrivilegedAccess_GcpIamAccess_{
+				GcpIamAccess: &privilegedaccessmanagerpb.PrivilegedAccess_GcpIamAccess{
+					RoleBindings: []*privilegedaccessmanagerpb.PrivilegedAccess_GcpIamAccess_RoleBinding{{Role: "roles/cloudsql.admin"}},
+				},
+			},
+		},
+	}
+}
+
+func newPolicyStore(t *testing.T, content string) *policy.Store {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := policy.NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestSweep(t *testing.T) {
+	store := newPolicyStore(t, `
+revocations:
+  - name: no-incident
+    expression: '!request.justification.startsWith("INC-")'
+    reason: not linked to an incident
+`)
+
+	var mu sync.Mutex
+	var asked []webhookRequest
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		asked = append(asked, req)
+		mu.Unlock()
+
+		// The incident of grant 3 was closed
+		_ = json.NewEncoder(w).Encode(webhookResponse{Revoke: req.Justification == "INC-3", Reason: "incident INC-3 is closed"})
+	}))
+	defer webhook.Close()
+
+	pam := &fakePAM{
+		grants: []*privilegedaccessmanagerpb.Grant{
+			grant("1", "jane@example.com", "INC-1", privilegedaccessmanagerpb.Grant_ACTIVE),
+			grant("2", "john@example.com", "debugging", privilegedaccessmanagerpb.Grant_ACTIVE),
+			grant("3", "jane@example.com", "INC-3", privilegedaccessmanagerpb.Grant_ACTIVE),
+			grant("4", "john@example.com", "debugging", privilegedaccessmanagerpb.Grant_ENDED),
+			grant("5", "jane@example.com", "INC-3", privilegedaccessmanagerpb.Grant_ACTIVATING),
+		},
+		revoked: map[string]string{},
+	}
+
+	credentials, err := services.NewCredentials(context.Background(), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := New([]string{testEntitlement, "invalid"}, store, webhook.URL, credentials)
+	worker.Sweep(context.Background(), pam)
+
+	want := map[string]string{
+		testEntitlement + "/grants/2": "Automatically revoked by no-incident: not linked to an incident",
+		testEntitlement + "/grants/3": "Automatically revoked by webhook: incident INC-3 is closed",
+	}
+	if len(pam.revoked) != len(want) {
+		t.Errorf("revoked %v, want %v", pam.revoked, want)
+	}
+	for name, reason := range want {
+		if pam.revoked[name] != reason {
+			t.Errorf("revoked %s with reason %q, want %q", name, pam.revoked[name], reason)
+		}
+	}
+
+	// Every page is listed with the active filter
+	if len(pam.filters) != 3 || slices.ContainsFunc(pam.filters, func(f string) bool { return f != activeFilter }) {
+		t.Errorf("filters = %q, want 3 pages filtered by %q", pam.filters, activeFilter)
+	}
+
+	// The webhook is only asked about active grants the policy did not revoke
+	if len(asked) != 2 {
+		t.Fatalf("webhook asked about %d grants, want 2", len(asked))
+	}
+	first := asked[0]
+	if first.Grant != testEntitlement+"/grants/1" || first.Requester != "jane@example.com" || first.Parent != "projects/prod" ||
+		first.Entitlement != "prod-admin" || first.Justification != "INC-1" || first.Duration != 3600 ||
+		!slices.Equal(first.Roles, []string{"roles/cloudsql.admin"}) || !first.CreateTime.Equal(time.Date(2024, time.June, 3, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("webhook request = %+v", first)
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantRevoke bool
+		wantErr    bool
+	}{
+		{"revoke", http.StatusOK, `{"revoke": true, "reason": "off call"}`, true, false},
+		{"keep", http.StatusOK, `{"revoke": false}`, false, false},
+		{"revoke without reason", http.StatusOK, `{"revoke": true}`, false, true},
+		{"error status", http.StatusInternalServerError, `{"revoke": true, "reason": "off call"}`, false, true},
+		{"invalid response", http.StatusOK, `revoke`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("webhook got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer webhook.Close()
+
+			worker := New(nil, nil, webhook.URL, nil)
+			g := grant("1", "jane@example.com", "INC-1", privilegedaccessmanagerpb.Grant_ACTIVE)
+			revocation, err := worker.checkWebhook(context.Background(), g, policy.Request{Requester: g.Requester})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkWebhook() error = %v, want error %v", err, tt.wantErr)
+			}
+			if revocation.Revoke != tt.wantRevoke {
+				t.Errorf("checkWebhook() = %+v, want revoke %v", revocation, tt.wantRevoke)
+			}
+		})
+	}
+}
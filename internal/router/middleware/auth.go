@@ -2,43 +2,218 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/idtoken"
+	"github.com/thoughtgears/pam-manager/internal/session"
+	"github.com/thoughtgears/pam-manager/internal/tokencache"
+	"github.com/thoughtgears/pam-manager/models"
+	"github.com/thoughtgears/pam-manager/services"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/oauth2/v1"
 	"google.golang.org/api/option"
 )
 
-const UserContextKey = "user"
+const (
+	UserContextKey      = "user"
+	PrincipalContextKey = "principal"
+	SessionContextKey   = "session"
+)
+
+// Token types of a principal
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeID      = "id_token"
+	TokenTypeIAP     = "iap"
+	TokenTypeSession = "session"
+)
+
+const (
+	serverlessAuthHeader = "X-Serverless-Authorization"
+	iapAssertionHeader   = "X-Goog-IAP-JWT-Assertion"
+)
+
+// Authenticator holds what AuthRequired needs to authenticate requests
+type Authenticator struct {
+	sessions  *session.Store
+	tokenInfo *oauth2.Service
+	idTokens  *idtoken.Verifier
+	iap       *idtoken.Verifier
+	groups    *services.GroupsService
+	tokens    *tokencache.Cache
+	clients   []string
+}
+
+// NewAuthenticator creates an authenticator. Google ID tokens are verified with idTokens, and IAP
+// assertions with iap, which is nil when the service is not behind IAP. The groups of the caller
+// are looked up with groups, unless it is nil. Access tokens are only accepted when they were issued
+// to one of the OAuth clients, and once validated with the tokeninfo endpoint they are cached in
+// tokens, which may be nil to validate every request.
+func NewAuthenticator(sessions *session.Store, idTokens, iap *idtoken.Verifier, groups *services.GroupsService, tokens *tokencache.Cache, clients []string) (*Authenticator, error) {
+	tokenInfo, err := oauth2.NewService(context.Background(), option.WithoutAuthentication())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OAuth2 service: %v", err)
+	}
 
-// AuthRequired middleware checks for a valid OAuth2 token
-func AuthRequired() gin.HandlerFunc {
+	return &Authenticator{
+		sessions:  sessions,
+		tokenInfo: tokenInfo,
+		idTokens:  idTokens,
+		iap:       iap,
+		groups:    groups,
+		tokens:    tokens,
+		clients:   clients,
+	}, nil
+}
+
+// AuthRequired middleware authenticates the request with, in order, a Google ID token or OAuth2 access
+// token as bearer token in Authorization or else X-Serverless-Authorization, a session cookie, or an IAP
+// assertion. ID tokens and IAP assertions are verified locally, access tokens with the tokeninfo endpoint.
+// The caller is set in the context as a principal, see CurrentPrincipal.
+func AuthRequired(auth *Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			log.Error().Msg("Missing or invalid token")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+		principal, ok := auth.authenticate(c)
+		if !ok {
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// Groups are looked up by email, so only for verified emails
+		if auth.groups != nil && principal.Email != "" && principal.EmailVerified {
+			groups, err := auth.groups.Groups(c, principal.Email)
+			if err != nil {
+				log.Error().Err(err).Str("user", principal.Email).Msg("Failed to look up groups")
+			}
+			principal.Groups = groups
+		}
+
+		c.Set(PrincipalContextKey, principal)
+		c.Set(UserContextKey, principal.Email)
+
+		c.Next()
+	}
+}
+
+// CurrentPrincipal returns the caller authenticated by AuthRequired, or nil on routes without it
+func CurrentPrincipal(c *gin.Context) *models.Principal {
+	principal, ok := c.Get(PrincipalContextKey)
+	if !ok {
+		return nil
+	}
+
+	return principal.(*models.Principal)
+}
+
+// PrincipalFromClaims maps the claims of a verified ID token or IAP assertion to a principal. IAP
+// assertions carry no email_verified claim, IAP only signs in users with their Google account.
+func PrincipalFromClaims(claims *idtoken.Claims, tokenType string) *models.Principal {
+	return &models.Principal{
+		Email:         claims.Email,
+		EmailVerified: (claims.EmailVerified != nil && *claims.EmailVerified) || tokenType == TokenTypeIAP,
+		Subject:       claims.Subject,
+		HostedDomain:  claims.HostedDomain,
+		TokenType:     tokenType,
+	}
+}
+
+// authenticate returns the caller of the request. If it fails, the error response is written and false is returned.
+func (auth *Authenticator) authenticate(c *gin.Context) (*models.Principal, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		authHeader = c.GetHeader(serverlessAuthHeader)
+	}
+
+	if authHeader == "" {
+		if s, ok := auth.sessions.Load(c.Request); ok {
+			c.Set(SessionContextKey, s)
+			principal := s.Principal
+			return &principal, true
+		}
+
+		if assertion := c.GetHeader(iapAssertionHeader); assertion != "" && auth.iap != nil {
+			claims, err := auth.iap.Verify(c, assertion)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to verify IAP assertion")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return nil, false
+			}
+
+			return PrincipalFromClaims(claims, TokenTypeIAP), true
+		}
+	}
+
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		log.Error().Msg("Missing or invalid token")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+		return nil, false
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		oauth2Service, err := oauth2.NewService(context.Background(), option.WithoutAuthentication())
+	if idtoken.IsJWT(tokenString) {
+		claims, err := auth.idTokens.Verify(c, tokenString)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to initialize OAuth2 service")
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize OAuth2 service"})
-			return
+			log.Error().Err(err).Msg("Failed to verify ID token")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return nil, false
 		}
 
-		if _, err := oauth2Service.Tokeninfo().AccessToken(tokenString).Do(); err != nil {
-			log.Error().Err(err).Msg("Failed to validate token")
+		return PrincipalFromClaims(claims, TokenTypeID), true
+	}
+
+	if principal, found := auth.tokens.Get(tokenString); found {
+		if principal == nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
+			return nil, false
 		}
 
-		c.Next()
+		return principal, true
 	}
+
+	tokenInfo, err := auth.tokenInfo.Tokeninfo().AccessToken(tokenString).Context(c).Do()
+	if err != nil {
+		// Only cache tokens the endpoint rejected, not failures to reach it
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+			auth.tokens.AddInvalid(tokenString)
+		}
+
+		log.Error().Err(err).Msg("Failed to validate token")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, false
+	}
+
+	// Tokens minted for other OAuth clients must not act as their user here
+	if !slices.Contains(auth.clients, tokenInfo.IssuedTo) && !slices.Contains(auth.clients, tokenInfo.Audience) {
+		auth.tokens.AddInvalid(tokenString)
+
+		log.Error().Str("issued_to", tokenInfo.IssuedTo).Msg("Token was issued to another OAuth client")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, false
+	}
+
+	// The email is only set for tokens with the userinfo.email scope. Access tokens carry no hosted domain.
+	principal := &models.Principal{
+		Email:         tokenInfo.Email,
+		EmailVerified: tokenInfo.VerifiedEmail || tokenInfo.EmailVerified,
+		Subject:       tokenInfo.UserId,
+		TokenType:     TokenTypeAccess,
+		Scopes:        strings.Fields(tokenInfo.Scope),
+	}
+	auth.tokens.Add(tokenString, principal, time.Duration(tokenInfo.ExpiresIn)*time.Second)
+
+	return principal, true
+}
+
+// TokenCacheStats returns the counters of the token validation cache
+func (auth *Authenticator) TokenCacheStats() tokencache.Stats {
+	return auth.tokens.Stats()
 }
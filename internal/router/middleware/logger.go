@@ -55,6 +55,10 @@ func StructuredLogger(logger *zerolog.Logger) gin.HandlerFunc {
 			logEvent = logger.Info()
 		}
 
+		if principal := CurrentPrincipal(c); principal != nil {
+			logEvent = logEvent.Str("user", principal.Email).Str("token_type", principal.TokenType)
+		}
+
 		logEvent.Str("client_id", param.ClientIP).
 			Str("method", param.Method).
 			Int("status_code", param.StatusCode).
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/thoughtgears/pam-manager/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// RequireRole middleware rejects callers without the role. It must run after AuthRequired.
+func RequireRole(policy *rbac.Policy, role rbac.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+		if !policy.Has(principal, role) {
+			event := log.Warn().Str("role", string(role)).Str("path", c.FullPath())
+			if principal != nil {
+				event = event.Str("user", principal.Email)
+			}
+			event.Msg("Caller is missing role")
+
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Requires the " + string(role) + " role"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRoleForQuery middleware rejects callers without the role when the query parameter is one
+// of the values, for endpoints that return what another role is allowed to see depending on the query.
+// It must run after AuthRequired.
+func RequireRoleForQuery(policy *rbac.Policy, role rbac.Role, param string, values ...string) gin.HandlerFunc {
+	requireRole := RequireRole(policy, role)
+
+	return func(c *gin.Context) {
+		if slices.Contains(values, c.Query(param)) {
+			requireRole(c)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thoughtgears/pam-manager/internal/rbac"
+	"github.com/thoughtgears/pam-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireRoleForQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	roles, err := rbac.New(map[rbac.Role][]string{
+		rbac.Requester: {"domain:example.com"},
+		rbac.Approver:  {"user:approver@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requester := &models.Principal{Email: "jane@example.com", EmailVerified: true, HostedDomain: "example.com"}
+	approver := &models.Principal{Email: "approver@example.com", EmailVerified: true, HostedDomain: "example.com"}
+
+	tests := []struct {
+		name       string
+		principal  *models.Principal
+		query      string
+		wantStatus int
+	}{
+		{"requester without relationship", requester, "", http.StatusOK},
+		{"requester created", requester, "?relationship=created", http.StatusOK},
+		{"requester can_approve", requester, "?relationship=can_approve", http.StatusForbidden},
+		{"requester had_approved", requester, "?relationship=had_approved", http.StatusForbidden},
+		{"approver can_approve", approver, "?relationship=can_approve", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.GET("/pam/me/grants",
+				func(c *gin.Context) { c.Set(PrincipalContextKey, tt.principal) },
+				RequireRole(roles, rbac.Requester),
+				RequireRoleForQuery(roles, rbac.Approver, "relationship", "can_approve", "had_approved"),
+				func(c *gin.Context) { c.Status(http.StatusOK) },
+			)
+
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pam/me/grants"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
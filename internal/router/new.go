@@ -12,6 +12,7 @@ import (
 
 type Router struct {
 	engine *gin.Engine
+	config *config.Config
 	debug  bool
 	host   string
 	port   string
@@ -29,6 +30,7 @@ func New(config *config.Config) (*Router, error) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	router.config = config
 	router.host = "0.0.0.0"
 	router.port = config.Port
 
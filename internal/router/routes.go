@@ -2,30 +2,64 @@ package router
 
 import (
 	"github.com/thoughtgears/pam-manager/handlers"
+	"github.com/thoughtgears/pam-manager/internal/rbac"
 	"github.com/thoughtgears/pam-manager/internal/router/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
-func (r *Router) RegisterRoutes(authHandler *handlers.AuthHandler, pamHandler *handlers.PamHandler) {
+func (r *Router) RegisterRoutes(authHandler *handlers.AuthHandler, pamHandler *handlers.PamHandler, slackHandler *handlers.SlackHandler, authenticator *middleware.Authenticator, roles *rbac.Policy) {
+	requester := middleware.RequireRole(roles, rbac.Requester)
+	approver := middleware.RequireRole(roles, rbac.Approver)
+	auditor := middleware.RequireRole(roles, rbac.Auditor)
+	admin := middleware.RequireRole(roles, rbac.Admin)
+
 	r.engine.Use(gin.Recovery(), middleware.Logger())
 
-	r.engine.POST("/debug", middleware.AuthRequired(), handlers.Debug)
+	r.engine.POST("/debug", middleware.AuthRequired(authenticator), admin, handlers.Debug)
+	r.engine.GET("/debug/token-cache", middleware.AuthRequired(authenticator), admin, handlers.TokenCacheStats(authenticator))
 
 	// Auth routes
 	auth := r.engine.Group("/auth")
 	{
 		auth.GET("/google/login", authHandler.Login)
 		auth.GET("/google/callback", authHandler.Callback)
+		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/logout", authHandler.Logout)
 	}
 
 	// PAM routes
 	pam := r.engine.Group("/pam")
-	pam.Use(middleware.AuthRequired())
+	pam.Use(middleware.AuthRequired(authenticator))
+	{
+		pam.GET("/grants", auditor, pamHandler.GetGrants)
+		pam.GET("/grants/:id", requester, pamHandler.GetGrant)
+		pam.POST("/grants", requester, pamHandler.RequestGrant)
+		pam.PATCH("/grants/:id", approver, pamHandler.ApproveGrant)
+		pam.POST("/grants/:id/deny", approver, pamHandler.DenyGrant)
+		pam.DELETE("/grants/:id", admin, pamHandler.RevokeGrant)
+
+		pam.GET("/entitlements", requester, pamHandler.GetEntitlements)
+		pam.POST("/entitlements", admin, pamHandler.CreateEntitlement)
+		pam.GET("/entitlements/:id", requester, pamHandler.GetEntitlement)
+		pam.PATCH("/entitlements/:id", admin, pamHandler.UpdateEntitlement)
+		pam.DELETE("/entitlements/:id", admin, pamHandler.DeleteEntitlement)
+
+		// Listing what the caller can approve is the same as /me/approvals
+		pam.GET("/me/entitlements", requester, middleware.RequireRoleForQuery(roles, rbac.Approver, "access", "approver"), pamHandler.MyEntitlements)
+		pam.GET("/me/grants", requester, middleware.RequireRoleForQuery(roles, rbac.Approver, "relationship", "can_approve", "had_approved"), pamHandler.MyGrants)
+		pam.GET("/me/approvals", approver, pamHandler.MyApprovals)
+
+		pam.GET("/operations/*name", auditor, pamHandler.GetOperation)
+
+		pam.POST("/policy/evaluate", requester, pamHandler.EvaluatePolicy)
+	}
+
+	// Slack routes, requests are authenticated by their Slack signature
+	slackRoutes := r.engine.Group("/slack")
+	slackRoutes.Use(middleware.SlackVerified(r.config.SlackSigningSecret))
 	{
-		pam.GET("/grants", pamHandler.GetGrants)
-		pam.POST("/grants", pamHandler.RequestGrant)
-		pam.PATCH("/grants/:id", pamHandler.ApproveGrant)
-		pam.DELETE("/grants/:id", pamHandler.RevokeGrant)
+		slackRoutes.POST("/commands", slackHandler.Command)
+		slackRoutes.POST("/interactions", slackHandler.Interaction)
 	}
 }
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/internal/cookie"
+	"github.com/thoughtgears/pam-manager/models"
+
+	"golang.org/x/oauth2"
+)
+
+// CookieName is the cookie holding the signed session ID
+const CookieName = "pam_session"
+
+// Session is a logged in user. The Google tokens stay on the server, the browser only gets the ID.
+type Session struct {
+	ID        string
+	Principal models.Principal
+	Expires   time.Time
+	// Token returns the user's access token, refreshing it with the refresh token when it expires
+	Token oauth2.TokenSource
+	// RefreshToken is kept to revoke the login when the session ends
+	RefreshToken string
+}
+
+// Store keeps sessions in memory, so they are lost on restart and not shared between instances
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	cookies  *cookie.Signer
+	ttl      time.Duration
+}
+
+// NewStore creates a session store, sessions last for ttl after login
+func NewStore(cookies *cookie.Signer, ttl time.Duration) *Store {
+	return &Store{
+		sessions: map[string]*Session{},
+		cookies:  cookies,
+		ttl:      ttl,
+	}
+}
+
+// TTL returns how long sessions last
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create starts a session and returns it along with the signed cookie value to send to the browser
+func (s *Store) Create(principal models.Principal, token oauth2.TokenSource, refreshToken string) (*Session, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate session ID: %v", err)
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:           base64.RawURLEncoding.EncodeToString(b),
+		Principal:    principal,
+		Expires:      now.Add(s.ttl),
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired sessions here, so the store does not grow with logins that were never ended
+	for id, existing := range s.sessions {
+		if now.After(existing.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[session.ID] = session
+
+	return session, s.cookies.Encode(CookieName, session.ID, session.Expires), nil
+}
+
+// Load returns the session of the request's session cookie, if it is valid and has not expired
+func (s *Store) Load(r *http.Request) (*Session, bool) {
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	id, err := s.cookies.Decode(CookieName, c.Value, now)
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+
+	if now.After(session.Expires) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+
+	return session, true
+}
+
+// SetToken replaces the tokens of the session. The session is replaced rather than changed, so
+// requests already holding it are not affected.
+func (s *Store) SetToken(id string, token oauth2.TokenSource, refreshToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+
+	updated := *existing
+	updated.Token = token
+	updated.RefreshToken = refreshToken
+	s.sessions[id] = &updated
+}
+
+// Delete ends the session
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
@@ -0,0 +1,176 @@
+package tokencache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/models"
+)
+
+// Cache remembers the outcome of validating tokens, so a token is not validated again on every
+// request. Entries are keyed by the SHA-256 of the token, the token itself is never stored. The
+// cache holds at most a fixed number of entries and evicts the least recently used. A nil cache
+// caches nothing.
+type Cache struct {
+	maxEntries  int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type entry struct {
+	key       [sha256.Size]byte
+	principal *models.Principal
+	expires   time.Time
+}
+
+// Stats are the counters of the cache
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// New creates a cache of at most maxEntries. Valid tokens are cached for ttl, or until they expire
+// if that is sooner, and invalid tokens for negativeTTL. A maxEntries of 0 disables the cache and
+// returns nil.
+func New(maxEntries int, ttl, negativeTTL time.Duration) *Cache {
+	if maxEntries <= 0 {
+		return nil
+	}
+
+	return &Cache{
+		maxEntries:  maxEntries,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     map[[sha256.Size]byte]*list.Element{},
+		order:       list.New(),
+	}
+}
+
+// Get returns the cached outcome for the token. If found is true, principal is the caller the token
+// belongs to, or nil if the token is invalid. The principal is a copy the caller may change.
+func (c *Cache) Get(token string) (principal *models.Principal, found bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if c.now().After(e.expires) {
+		c.remove(element)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+
+	if e.principal == nil {
+		return nil, true
+	}
+	p := *e.principal
+	return &p, true
+}
+
+// Add caches a valid token of the principal, which expires after expiresIn
+func (c *Cache) Add(token string, principal *models.Principal, expiresIn time.Duration) {
+	if c == nil {
+		return
+	}
+
+	p := *principal
+	c.add(token, &p, min(c.ttl, expiresIn))
+}
+
+// AddInvalid caches that the token is invalid
+func (c *Cache) AddInvalid(token string) {
+	if c == nil {
+		return
+	}
+
+	c.add(token, nil, c.negativeTTL)
+}
+
+// Remove forgets the token, e.g. after it was revoked
+func (c *Cache) Remove(token string) {
+	if c == nil {
+		return
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Stats returns the hit and miss counters and the number of entries
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
+
+func (c *Cache) add(token string, principal *models.Principal, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	key := sha256.Sum256([]byte(token))
+	e := &entry{key: key, principal: principal, expires: c.now().Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = e
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(e)
+
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
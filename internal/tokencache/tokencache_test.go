@@ -0,0 +1,172 @@
+package tokencache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thoughtgears/pam-manager/models"
+)
+
+// clock is a fake time for the cache, moved forward with advance
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestCache(maxEntries int, ttl, negativeTTL time.Duration) (*Cache, *clock) {
+	clk := &clock{now: time.Date(2024, time.June, 3, 10, 0, 0, 0, time.UTC)}
+	cache := New(maxEntries, ttl, negativeTTL)
+	cache.now = func() time.Time { return clk.now }
+
+	return cache, clk
+}
+
+var jane = &models.Principal{Email: "jane@example.com", EmailVerified: true}
+
+func TestExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		add       func(c *Cache)
+		after     time.Duration
+		wantFound bool
+		wantValid bool
+	}{
+		{"valid token within ttl", func(c *Cache) { c.Add("token", jane, time.Hour) }, 4 * time.Minute, true, true},
+		{"valid token after ttl", func(c *Cache) { c.Add("token", jane, time.Hour) }, 6 * time.Minute, false, false},
+		{"token expiring before ttl", func(c *Cache) { c.Add("token", jane, time.Minute) }, 2 * time.Minute, false, false},
+		{"token expiring before ttl, within expiry", func(c *Cache) { c.Add("token", jane, time.Minute) }, 30 * time.Second, true, true},
+		{"expired token is not cached", func(c *Cache) { c.Add("token", jane, 0) }, 0, false, false},
+		{"invalid token within negative ttl", func(c *Cache) { c.AddInvalid("token") }, 20 * time.Second, true, false},
+		{"invalid token after negative ttl", func(c *Cache) { c.AddInvalid("token") }, 40 * time.Second, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, clk := newTestCache(10, 5*time.Minute, 30*time.Second)
+			tt.add(cache)
+			clk.advance(tt.after)
+
+			principal, found := cache.Get("token")
+			if found != tt.wantFound || (principal != nil) != tt.wantValid {
+				t.Errorf("Get() = %v, %v, want found %v and valid %v", principal, found, tt.wantFound, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestEviction(t *testing.T) {
+	cache, _ := newTestCache(2, time.Hour, time.Hour)
+
+	cache.Add("a", jane, time.Hour)
+	cache.Add("b", jane, time.Hour)
+	// Using a makes b the least recently used
+	cache.Get("a")
+	cache.Add("c", jane, time.Hour)
+
+	for token, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, found := cache.Get(token); found != want {
+			t.Errorf("Get(%q) found = %v, want %v", token, found, want)
+		}
+	}
+	if entries := cache.Stats().Entries; entries != 2 {
+		t.Errorf("entries = %d, want 2", entries)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	cache, _ := newTestCache(10, time.Hour, time.Hour)
+
+	cache.Add("token", jane, time.Hour)
+	cache.Remove("token")
+	cache.Remove("unknown")
+
+	if _, found := cache.Get("token"); found {
+		t.Error("Get() found a removed token")
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	cache, _ := newTestCache(10, time.Hour, time.Hour)
+	cache.Add("token", jane, time.Hour)
+
+	principal, _ := cache.Get("token")
+	principal.Groups = append(principal.Groups, "admins@example.com")
+
+	if principal, _ := cache.Get("token"); len(principal.Groups) != 0 {
+		t.Errorf("cached principal was changed: %+v", principal)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	cache := New(0, time.Hour, time.Hour)
+	if cache != nil {
+		t.Fatal("New() with size 0 returned a cache")
+	}
+
+	cache.Add("token", jane, time.Hour)
+	cache.AddInvalid("invalid")
+	cache.Remove("token")
+
+	if _, found := cache.Get("token"); found {
+		t.Error("Get() found a token in a disabled cache")
+	}
+	if stats := cache.Stats(); stats != (Stats{}) {
+		t.Errorf("Stats() = %+v, want zero", stats)
+	}
+}
+
+func TestStats(t *testing.T) {
+	cache, clk := newTestCache(10, time.Minute, time.Minute)
+
+	cache.Get("token")
+	cache.Add("token", jane, time.Hour)
+	cache.Get("token")
+	cache.AddInvalid("invalid")
+	cache.Get("invalid")
+	clk.advance(2 * time.Minute)
+	// Expired entries count as misses, and are removed
+	cache.Get("token")
+
+	want := Stats{Hits: 2, Misses: 2, Entries: 1}
+	if stats := cache.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	cache := New(50, time.Hour, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 200 {
+				token := fmt.Sprintf("token-%d", (i*200+j)%100)
+				switch j % 4 {
+				case 0:
+					cache.Add(token, jane, time.Hour)
+				case 1:
+					cache.AddInvalid(token)
+				case 2:
+					cache.Remove(token)
+				default:
+					cache.Get(token)
+				}
+				cache.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	if stats.Entries > 50 {
+		t.Errorf("entries = %d, want at most 50", stats.Entries)
+	}
+	if stats.Hits+stats.Misses != 8*50 {
+		t.Errorf("hits + misses = %d, want %d", stats.Hits+stats.Misses, 8*50)
+	}
+}
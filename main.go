@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"github.com/thoughtgears/pam-manager/handlers"
+	"github.com/thoughtgears/pam-manager/internal/cli"
 	"github.com/thoughtgears/pam-manager/internal/config"
+	"github.com/thoughtgears/pam-manager/internal/cookie"
+	"github.com/thoughtgears/pam-manager/internal/idtoken"
+	"github.com/thoughtgears/pam-manager/internal/policy"
+	"github.com/thoughtgears/pam-manager/internal/rbac"
+	"github.com/thoughtgears/pam-manager/internal/revoker"
 	"github.com/thoughtgears/pam-manager/internal/router"
+	"github.com/thoughtgears/pam-manager/internal/router/middleware"
+	"github.com/thoughtgears/pam-manager/internal/session"
+	"github.com/thoughtgears/pam-manager/internal/tokencache"
 	"github.com/thoughtgears/pam-manager/services"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
 )
 
 var cfg config.Config
@@ -16,14 +29,80 @@ var cfg config.Config
 func init() {
 	zerolog.LevelFieldName = "severity"
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
-	envconfig.MustProcess("", &cfg)
 }
 
 func main() {
-	authService := services.NewAuthService(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL)
-	authHandler := handlers.NewAuthHandler(authService)
-	pamHandler := handlers.NewPamHandler()
+	if len(os.Args) > 1 && os.Args[1] == "policy" {
+		os.Exit(cli.Policy(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	envconfig.MustProcess("", &cfg)
+
+	// The ID token of a login is minted for the OAuth client
+	loginTokens := idtoken.NewVerifier(cfg.GoogleJWKSURL, idtoken.GoogleIssuers, []string{cfg.GoogleClientID}, cfg.AllowedHostedDomains)
+	endpoint := oauth2.Endpoint{AuthURL: cfg.GoogleAuthURL, TokenURL: cfg.GoogleTokenURL, AuthStyle: oauth2.AuthStyleInParams}
+	authService := services.NewAuthService(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL, endpoint, cfg.GoogleRevokeURL, loginTokens)
+	cookies, err := cookie.NewSigner(cfg.CookieSecret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid COOKIE_SECRET")
+	}
+	sessions := session.NewStore(cookies, cfg.SessionTTL)
+
+	// Validated access tokens are cached, unless the cache size is 0
+	tokens := tokencache.New(cfg.TokenCacheSize, cfg.TokenCacheTTL, cfg.TokenCacheNegativeTTL)
+
+	authHandler := handlers.NewAuthHandler(authService, cookies, sessions, tokens)
+	slackService := services.NewSlackService(cfg.SlackToken, cfg.SlackApproverChannel)
+
+	var policyStore *policy.Store
+	if cfg.PolicyFile != "" {
+		var err error
+		policyStore, err = policy.NewStore(cfg.PolicyFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load policy file")
+		}
+
+		go policyStore.Watch(context.Background(), cfg.PolicyReloadInterval)
+	}
+
+	credentials, err := services.NewCredentials(context.Background(), cfg.Credentials, cfg.ImpersonateServiceAccount)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure credentials")
+	}
+
+	if len(cfg.RevokeEntitlements) > 0 {
+		if policyStore == nil && cfg.RevokeWebhookURL == "" {
+			log.Warn().Msg("REVOKE_ENTITLEMENTS is set without POLICY_FILE or REVOKE_WEBHOOK_URL, no grants will be revoked")
+		}
+
+		worker := revoker.New(cfg.RevokeEntitlements, policyStore, cfg.RevokeWebhookURL, credentials)
+		go worker.Run(context.Background(), cfg.RevokeInterval)
+	}
+
+	var groups *services.GroupsService
+	if cfg.CloudIdentityGroups {
+		groups, err = services.NewGroupsService(context.Background())
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create groups service")
+		}
+	}
+
+	pamHandler := handlers.NewPamHandler(slackService, policyStore, credentials)
+
+	roles, err := rbac.New(map[rbac.Role][]string{
+		rbac.Admin:     cfg.RoleAdmins,
+		rbac.Approver:  cfg.RoleApprovers,
+		rbac.Auditor:   cfg.RoleAuditors,
+		rbac.Requester: cfg.RoleRequesters,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load roles")
+	}
+	if len(cfg.RoleRequesters) == 0 && len(cfg.RoleAdmins) == 0 {
+		log.Warn().Msg("Neither ROLE_REQUESTERS nor ROLE_ADMINS is set, no one can request grants")
+	}
+
+	slackHandler := handlers.NewSlackHandler(slackService, policyStore, groups, roles, credentials, cfg.SlackDelegationServiceAccount)
 
 	// Create the router
 	r, err := router.New(&cfg)
@@ -31,6 +110,29 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to create router")
 	}
 
-	r.RegisterRoutes(authHandler, pamHandler)
+	// ID tokens minted for the OAuth client are accepted unless other audiences are configured
+	audiences := cfg.IDTokenAudiences
+	if len(audiences) == 0 {
+		audiences = []string{cfg.GoogleClientID}
+	}
+	idTokens := idtoken.NewVerifier(cfg.GoogleJWKSURL, idtoken.GoogleIssuers, audiences, cfg.AllowedHostedDomains)
+
+	var iap *idtoken.Verifier
+	if cfg.IAPAudience != "" {
+		iap = idtoken.NewVerifier(cfg.IAPJWKSURL, idtoken.IAPIssuers, []string{cfg.IAPAudience}, cfg.AllowedHostedDomains)
+	}
+
+	// Access tokens issued to the OAuth client are accepted unless other clients are configured
+	clients := cfg.AccessTokenClients
+	if len(clients) == 0 {
+		clients = []string{cfg.GoogleClientID}
+	}
+
+	authenticator, err := middleware.NewAuthenticator(sessions, idTokens, iap, groups, tokens, clients)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create authenticator")
+	}
+
+	r.RegisterRoutes(authHandler, pamHandler, slackHandler, authenticator, roles)
 	log.Fatal().Err(r.Run()).Msg("Failed to start server")
 }
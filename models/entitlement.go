@@ -0,0 +1,26 @@
+package models
+
+type Entitlement struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	State                string            `json:"state"`
+	EligibleUsers        []string          `json:"eligible_users"`
+	ApprovalWorkflow     *ApprovalWorkflow `json:"approval_workflow,omitempty"`
+	MaxDuration          int64             `json:"max_duration"`
+	RoleBindings         []RoleBinding     `json:"role_bindings"`
+	RequireJustification bool              `json:"require_justification"`
+	Etag                 string            `json:"etag"`
+}
+
+// ApprovalWorkflow is a single step of manual approvals, entitlements without
+// an approval workflow are granted without approval
+type ApprovalWorkflow struct {
+	Approvers                    []string `json:"approvers" binding:"required"`
+	ApprovalsNeeded              int32    `json:"approvals_needed"`
+	RequireApproverJustification bool     `json:"require_approver_justification"`
+}
+
+type RoleBinding struct {
+	Role                string `json:"role" binding:"required"`
+	ConditionExpression string `json:"condition_expression,omitempty"`
+}
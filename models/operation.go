@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Operation is a long-running PAM operation. When it is done, either Error is set or the
+// resulting Grant or Entitlement is.
+type Operation struct {
+	Name        string       `json:"name"`
+	Done        bool         `json:"done"`
+	Verb        string       `json:"verb,omitempty"`
+	Target      string       `json:"target,omitempty"`
+	CreateTime  time.Time    `json:"create_time"`
+	Error       string       `json:"error,omitempty"`
+	Grant       *Grant       `json:"grant,omitempty"`
+	Entitlement *Entitlement `json:"entitlement,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Principal is the authenticated caller of the API
+type Principal struct {
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Subject       string   `json:"subject"`
+	HostedDomain  string   `json:"hosted_domain,omitempty"`
+	TokenType     string   `json:"token_type"`
+	Scopes        []string `json:"scopes,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+}
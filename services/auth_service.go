@@ -2,37 +2,128 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/thoughtgears/pam-manager/internal/idtoken"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"google.golang.org/api/impersonate"
 )
 
+// ErrInvalidIDToken is returned by HandleCallback when the ID token of a login is rejected, e.g.
+// for a hosted domain that is not allowed
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
 type AuthService struct {
 	oauthConfig *oauth2.Config
+	revokeURL   string
+	idTokens    *idtoken.Verifier
 }
 
-func NewAuthService(clientID, clientSecret, redirectURL string) *AuthService {
+// NewAuthService creates the Google login service using the authorization and token URLs of endpoint,
+// usually google.Endpoint, and tokens are revoked at revokeURL. The ID token returned by a login is
+// verified with idTokens, which must accept the client ID as audience.
+func NewAuthService(clientID, clientSecret, redirectURL string, endpoint oauth2.Endpoint, revokeURL string, idTokens *idtoken.Verifier) *AuthService {
 	return &AuthService{
+		revokeURL: revokeURL,
+		idTokens:  idTokens,
 		oauthConfig: &oauth2.Config{
 			ClientID:     clientID,
 			ClientSecret: clientSecret,
 			RedirectURL:  redirectURL,
-			Scopes:       []string{"https://www.googleapis.com/auth/cloud-platform"},
-			Endpoint:     google.Endpoint,
+			Scopes:       []string{"openid", "https://www.googleapis.com/auth/cloud-platform", "https://www.googleapis.com/auth/userinfo.email"},
+			Endpoint:     endpoint,
 		},
 	}
 }
 
-func (a *AuthService) GetLoginURL(state string) string {
-	return a.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+// GetLoginURL returns the Google consent URL. State is echoed back to the callback, and the
+// PKCE verifier must be passed to HandleCallback, only its S256 challenge is sent here.
+func (a *AuthService) GetLoginURL(state, verifier string) string {
+	return a.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+}
+
+// HandleCallback exchanges the authorization code and PKCE verifier for a token, and returns it with
+// the claims of the verified ID token identifying the user
+func (a *AuthService) HandleCallback(ctx context.Context, code, verifier string) (*oauth2.Token, *idtoken.Claims, error) {
+	token, err := a.oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, nil, errors.New("token response has no ID token")
+	}
+
+	claims, err := a.idTokens.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	return token, claims, nil
+}
+
+// TokenSource returns a token source that starts with token and refreshes it with its refresh token.
+// Refreshes are made with ctx, so it must live as long as the token source.
+func (a *AuthService) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return a.oauthConfig.TokenSource(ctx, token)
 }
 
-// HandleCallback exchanges the authorization code for a token and returns both the token and the HTTP client
-func (a *AuthService) HandleCallback(ctx context.Context, code string) (*oauth2.Token, error) {
-	token, err := a.oauthConfig.Exchange(ctx, code)
+// Refresh mints a new access token from the refresh token
+func (a *AuthService) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	token, err := a.oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to refresh token: %v", err)
+	}
+
+	// The refresh token is only returned when Google rotates it
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
 	}
 
 	return token, nil
 }
+
+// Revoke revokes an access or refresh token at Google. Revoking a refresh token also revokes
+// the access tokens minted from it.
+func (a *AuthService) Revoke(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.revokeURL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to revoke token: %s: %s", resp.Status, body)
+	}
+
+	return nil
+}
+
+// DelegatedTokenSource returns a token source acting as subject, using domain-wide delegation
+// granted to serviceAccount. The service's own credentials must be able to impersonate serviceAccount.
+func DelegatedTokenSource(ctx context.Context, serviceAccount, subject string) (oauth2.TokenSource, error) {
+	tokenSource, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: serviceAccount,
+		Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+		Subject:         subject,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delegated token source: %v", err)
+	}
+
+	return tokenSource, nil
+}
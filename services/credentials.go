@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/impersonate"
+)
+
+// CredentialMode is whose credentials an operation calls PAM with, which decides who it is
+// attributed to in the GCP audit logs
+type CredentialMode string
+
+const (
+	// CredentialsCaller calls PAM as the caller, with their session or bearer access token
+	CredentialsCaller CredentialMode = "caller"
+	// CredentialsServiceAccount calls PAM with the service's own credentials
+	CredentialsServiceAccount CredentialMode = "service_account"
+	// CredentialsImpersonate calls PAM as a target service account impersonated by the service
+	CredentialsImpersonate CredentialMode = "impersonate"
+)
+
+// Operations whose credentials can be configured
+const (
+	OperationGrantList         = "grant.list"
+	OperationGrantGet          = "grant.get"
+	OperationGrantRequest      = "grant.request"
+	OperationGrantApprove      = "grant.approve"
+	OperationGrantDeny         = "grant.deny"
+	OperationGrantRevoke       = "grant.revoke"
+	OperationEntitlementList   = "entitlement.list"
+	OperationEntitlementGet    = "entitlement.get"
+	OperationEntitlementCreate = "entitlement.create"
+	OperationEntitlementUpdate = "entitlement.update"
+	OperationEntitlementDelete = "entitlement.delete"
+	OperationOperationGet      = "operation.get"
+	OperationPolicyEvaluate    = "policy.evaluate"
+	OperationGrantAutoApprove  = "grant.auto_approve"
+	OperationGrantAutoRevoke   = "grant.auto_revoke"
+)
+
+// backgroundOperations are done by the service on its own, without a caller to act as
+var backgroundOperations = []string{OperationGrantAutoApprove, OperationGrantAutoRevoke}
+
+// DefaultCredentials are the credential modes of the operations when they are not configured
+var DefaultCredentials = map[string]CredentialMode{
+	OperationGrantList:         CredentialsServiceAccount,
+	OperationGrantGet:          CredentialsCaller,
+	OperationGrantRequest:      CredentialsCaller,
+	OperationGrantApprove:      CredentialsCaller,
+	OperationGrantDeny:         CredentialsCaller,
+	OperationGrantRevoke:       CredentialsServiceAccount,
+	OperationEntitlementList:   CredentialsCaller,
+	OperationEntitlementGet:    CredentialsCaller,
+	OperationEntitlementCreate: CredentialsCaller,
+	OperationEntitlementUpdate: CredentialsCaller,
+	OperationEntitlementDelete: CredentialsCaller,
+	OperationOperationGet:      CredentialsServiceAccount,
+	OperationPolicyEvaluate:    CredentialsCaller,
+	OperationGrantAutoApprove:  CredentialsServiceAccount,
+	OperationGrantAutoRevoke:   CredentialsServiceAccount,
+}
+
+// Credentials holds the credential mode of each operation
+type Credentials struct {
+	modes          map[string]CredentialMode
+	serviceAccount string
+	impersonated   oauth2.TokenSource
+}
+
+// NewCredentials overrides the default modes of the operations with modes, keyed by operation.
+// Operations in impersonate mode act as serviceAccount, which the service's own credentials must be
+// able to create tokens for.
+func NewCredentials(ctx context.Context, modes map[string]string, serviceAccount string) (*Credentials, error) {
+	credentials := &Credentials{
+		modes:          maps.Clone(DefaultCredentials),
+		serviceAccount: serviceAccount,
+	}
+
+	for operation, mode := range modes {
+		if _, ok := DefaultCredentials[operation]; !ok {
+			return nil, fmt.Errorf("unknown operation %q, must be one of %s", operation, strings.Join(slices.Sorted(maps.Keys(DefaultCredentials)), ", "))
+		}
+
+		switch m := CredentialMode(mode); m {
+		case CredentialsCaller:
+			if slices.Contains(backgroundOperations, operation) {
+				return nil, fmt.Errorf("invalid credential mode %q for %s, it has no caller and must be service_account or impersonate", mode, operation)
+			}
+			credentials.modes[operation] = m
+		case CredentialsServiceAccount, CredentialsImpersonate:
+			credentials.modes[operation] = m
+		default:
+			return nil, fmt.Errorf("invalid credential mode %q for %s, must be caller, service_account or impersonate", mode, operation)
+		}
+	}
+
+	if !slices.Contains(slices.Collect(maps.Values(credentials.modes)), CredentialsImpersonate) {
+		return credentials, nil
+	}
+
+	if serviceAccount == "" {
+		return nil, errors.New("a service account to impersonate is required by operations in impersonate mode")
+	}
+
+	// The token source caches its tokens, so it is shared by all requests
+	tokenSource, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: serviceAccount,
+		Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create impersonated token source: %v", err)
+	}
+	credentials.impersonated = tokenSource
+
+	return credentials, nil
+}
+
+// Mode returns the credential mode of the operation
+func (c *Credentials) Mode(operation string) CredentialMode {
+	return c.modes[operation]
+}
+
+// ServiceAccount returns the service account impersonated in impersonate mode
+func (c *Credentials) ServiceAccount() string {
+	return c.serviceAccount
+}
+
+// TokenSource returns the token source of a mode other than caller, nil being the service's own credentials
+func (c *Credentials) TokenSource(mode CredentialMode) oauth2.TokenSource {
+	if mode == CredentialsImpersonate {
+		return c.impersonated
+	}
+
+	return nil
+}
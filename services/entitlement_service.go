@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	privilegedaccessmanager "cloud.google.com/go/privilegedaccessmanager/apiv1"
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func (p *PAMService) GetEntitlements(ctx context.Context, parent Parent) ([]*privilegedaccessmanagerpb.Entitlement, error) {
+	req := &privilegedaccessmanagerpb.ListEntitlementsRequest{
+		Parent: parent.String(),
+	}
+
+	itr := p.client.ListEntitlements(ctx, req)
+
+	var entitlements []*privilegedaccessmanagerpb.Entitlement
+	for {
+		entitlement, err := itr.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get entitlement: %v", err)
+		}
+
+		entitlements = append(entitlements, entitlement)
+	}
+
+	return entitlements, nil
+}
+
+func (p *PAMService) GetEntitlement(ctx context.Context, parent Parent, entitlement string) (*privilegedaccessmanagerpb.Entitlement, error) {
+	req := &privilegedaccessmanagerpb.GetEntitlementRequest{
+		Name: parent.EntitlementName(entitlement),
+	}
+
+	return p.client.GetEntitlement(ctx, req)
+}
+
+// CreateEntitlement creates the entitlement and waits for the operation to finish
+func (p *PAMService) CreateEntitlement(ctx context.Context, parent Parent, entitlementId string, entitlement *privilegedaccessmanagerpb.Entitlement) (*privilegedaccessmanagerpb.Entitlement, error) {
+	op, err := p.createEntitlement(ctx, parent, entitlementId, entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.Wait(ctx)
+}
+
+// CreateEntitlementAsync starts creating the entitlement and returns the name of the operation
+func (p *PAMService) CreateEntitlementAsync(ctx context.Context, parent Parent, entitlementId string, entitlement *privilegedaccessmanagerpb.Entitlement) (string, error) {
+	op, err := p.createEntitlement(ctx, parent, entitlementId, entitlement)
+	if err != nil {
+		return "", err
+	}
+
+	return op.Name(), nil
+}
+
+func (p *PAMService) createEntitlement(ctx context.Context, parent Parent, entitlementId string, entitlement *privilegedaccessmanagerpb.Entitlement) (*privilegedaccessmanager.CreateEntitlementOperation, error) {
+	req := &privilegedaccessmanagerpb.CreateEntitlementRequest{
+		Parent:        parent.String(),
+		EntitlementId: entitlementId,
+		Entitlement:   entitlement,
+	}
+
+	op, err := p.client.CreateEntitlement(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entitlement: %v", err)
+	}
+
+	return op, nil
+}
+
+// UpdateEntitlement updates the given fields of the entitlement and waits for the operation to finish.
+// The entitlement name identifies the entitlement to update.
+func (p *PAMService) UpdateEntitlement(ctx context.Context, entitlement *privilegedaccessmanagerpb.Entitlement, paths []string) (*privilegedaccessmanagerpb.Entitlement, error) {
+	op, err := p.updateEntitlement(ctx, entitlement, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.Wait(ctx)
+}
+
+// UpdateEntitlementAsync starts updating the entitlement and returns the name of the operation
+func (p *PAMService) UpdateEntitlementAsync(ctx context.Context, entitlement *privilegedaccessmanagerpb.Entitlement, paths []string) (string, error) {
+	op, err := p.updateEntitlement(ctx, entitlement, paths)
+	if err != nil {
+		return "", err
+	}
+
+	return op.Name(), nil
+}
+
+func (p *PAMService) updateEntitlement(ctx context.Context, entitlement *privilegedaccessmanagerpb.Entitlement, paths []string) (*privilegedaccessmanager.UpdateEntitlementOperation, error) {
+	req := &privilegedaccessmanagerpb.UpdateEntitlementRequest{
+		Entitlement: entitlement,
+		UpdateMask:  &fieldmaskpb.FieldMask{Paths: paths},
+	}
+
+	op, err := p.client.UpdateEntitlement(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update entitlement: %v", err)
+	}
+
+	return op, nil
+}
+
+// DeleteEntitlement deletes the entitlement and waits for the operation to finish. Entitlements with
+// active grants can only be deleted with force.
+func (p *PAMService) DeleteEntitlement(ctx context.Context, parent Parent, entitlement string, force bool) (*privilegedaccessmanagerpb.Entitlement, error) {
+	op, err := p.deleteEntitlement(ctx, parent, entitlement, force)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.Wait(ctx)
+}
+
+// DeleteEntitlementAsync starts deleting the entitlement and returns the name of the operation
+func (p *PAMService) DeleteEntitlementAsync(ctx context.Context, parent Parent, entitlement string, force bool) (string, error) {
+	op, err := p.deleteEntitlement(ctx, parent, entitlement, force)
+	if err != nil {
+		return "", err
+	}
+
+	return op.Name(), nil
+}
+
+func (p *PAMService) deleteEntitlement(ctx context.Context, parent Parent, entitlement string, force bool) (*privilegedaccessmanager.DeleteEntitlementOperation, error) {
+	req := &privilegedaccessmanagerpb.DeleteEntitlementRequest{
+		Name:  parent.EntitlementName(entitlement),
+		Force: force,
+	}
+
+	op, err := p.client.DeleteEntitlement(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete entitlement: %v", err)
+	}
+
+	return op, nil
+}
+
+// SearchEntitlements returns the entitlements the caller can request or approve grants for
+func (p *PAMService) SearchEntitlements(ctx context.Context, parent Parent, accessType privilegedaccessmanagerpb.SearchEntitlementsRequest_CallerAccessType) ([]*privilegedaccessmanagerpb.Entitlement, error) {
+	req := &privilegedaccessmanagerpb.SearchEntitlementsRequest{
+		Parent:           parent.String(),
+		CallerAccessType: accessType,
+	}
+
+	itr := p.client.SearchEntitlements(ctx, req)
+
+	var entitlements []*privilegedaccessmanagerpb.Entitlement
+	for {
+		entitlement, err := itr.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to search entitlements: %v", err)
+		}
+
+		entitlements = append(entitlements, entitlement)
+	}
+
+	return entitlements, nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudidentity/v1"
+)
+
+// groupsCacheTTL is how long the groups of a user are cached
+const groupsCacheTTL = 10 * time.Minute
+
+// GroupsService looks up the Google groups a user is a member of, directly or through other groups,
+// with Cloud Identity. The service's own credentials need to be able to read group memberships.
+type GroupsService struct {
+	service *cloudidentity.Service
+
+	mu    sync.Mutex
+	cache map[string]cachedGroups
+}
+
+type cachedGroups struct {
+	groups  []string
+	expires time.Time
+}
+
+func NewGroupsService(ctx context.Context) (*GroupsService, error) {
+	service, err := cloudidentity.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud Identity service: %v", err)
+	}
+
+	return &GroupsService{
+		service: service,
+		cache:   map[string]cachedGroups{},
+	}, nil
+}
+
+// Groups returns the emails of the groups the user is a member of
+func (g *GroupsService) Groups(ctx context.Context, email string) ([]string, error) {
+	now := time.Now()
+
+	g.mu.Lock()
+	cached, ok := g.cache[email]
+	g.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.groups, nil
+	}
+
+	if strings.ContainsAny(email, `'"\`) {
+		return nil, fmt.Errorf("invalid email: %q", email)
+	}
+	query := fmt.Sprintf("member_key_id == '%s' && 'cloudidentity.googleapis.com/groups.discussion_forum' in labels", email)
+
+	groups := []string{}
+	err := g.service.Groups.Memberships.SearchTransitiveGroups("groups/-").Query(query).Pages(ctx, func(resp *cloudidentity.SearchTransitiveGroupsResponse) error {
+		for _, membership := range resp.Memberships {
+			if membership.GroupKey != nil {
+				groups = append(groups, membership.GroupKey.Id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search groups: %v", err)
+	}
+
+	g.mu.Lock()
+	g.cache[email] = cachedGroups{groups: groups, expires: now.Add(groupsCacheTTL)}
+	g.mu.Unlock()
+
+	return groups, nil
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+)
+
+// GetOperation returns the long-running operation, e.g. one started by RevokeGrantAsync
+func (p *PAMService) GetOperation(ctx context.Context, name string) (*longrunningpb.Operation, error) {
+	req := &longrunningpb.GetOperationRequest{
+		Name: name,
+	}
+
+	op, err := p.client.GetOperation(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation: %w", err)
+	}
+
+	return op, nil
+}
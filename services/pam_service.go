@@ -41,13 +41,50 @@ func NewPAMService(ctx context.Context, token oauth2.TokenSource) (*PAMService,
 	}, nil
 }
 
-func (p *PAMService) GetGrants(ctx context.Context, project, entitlement string) ([]*privilegedaccessmanagerpb.Grant, error) {
+// Close closes the connection of the PAM client
+func (p *PAMService) Close() error {
+	return p.client.Close()
+}
+
+// ListOptions pages, filters and orders a listing. Filter and OrderBy use the
+// syntax of the PAM API, e.g. state = "ACTIVE" and create_time desc.
+type ListOptions struct {
+	PageSize  int
+	PageToken string
+	Filter    string
+	OrderBy   string
+}
+
+// GetGrants returns a page of grants of the entitlement and the token for the next page,
+// which is empty on the last page
+func (p *PAMService) GetGrants(ctx context.Context, parent Parent, entitlement string, opts ListOptions) ([]*privilegedaccessmanagerpb.Grant, string, error) {
 	req := &privilegedaccessmanagerpb.ListGrantsRequest{
-		Parent: fmt.Sprintf("projects/%s/locations/global/entitlements/%s", project, entitlement),
+		Parent:  parent.EntitlementName(entitlement),
+		Filter:  opts.Filter,
+		OrderBy: opts.OrderBy,
 	}
 
 	itr := p.client.ListGrants(ctx, req)
 
+	var grants []*privilegedaccessmanagerpb.Grant
+	nextPageToken, err := iterator.NewPager(itr, opts.PageSize, opts.PageToken).NextPage(&grants)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get grants: %w", err)
+	}
+
+	return grants, nextPageToken, nil
+}
+
+// SearchGrants returns the grants the caller has the given relationship with. Use "-" as
+// entitlement to search across all entitlements of the parent.
+func (p *PAMService) SearchGrants(ctx context.Context, parent Parent, entitlement string, relationship privilegedaccessmanagerpb.SearchGrantsRequest_CallerRelationshipType) ([]*privilegedaccessmanagerpb.Grant, error) {
+	req := &privilegedaccessmanagerpb.SearchGrantsRequest{
+		Parent:             parent.EntitlementName(entitlement),
+		CallerRelationship: relationship,
+	}
+
+	itr := p.client.SearchGrants(ctx, req)
+
 	var grants []*privilegedaccessmanagerpb.Grant
 	for {
 		grant, err := itr.Next()
@@ -55,7 +92,7 @@ func (p *PAMService) GetGrants(ctx context.Context, project, entitlement string)
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to get grant: %v", err)
+			return nil, fmt.Errorf("failed to search grants: %v", err)
 		}
 
 		grants = append(grants, grant)
@@ -64,9 +101,17 @@ func (p *PAMService) GetGrants(ctx context.Context, project, entitlement string)
 	return grants, nil
 }
 
-func (p *PAMService) RequestGrant(ctx context.Context, projectId, entitlement, reason string, duration int64) (*privilegedaccessmanagerpb.Grant, error) {
+func (p *PAMService) GetGrant(ctx context.Context, parent Parent, entitlement, id string) (*privilegedaccessmanagerpb.Grant, error) {
+	req := &privilegedaccessmanagerpb.GetGrantRequest{
+		Name: parent.GrantName(entitlement, id),
+	}
+
+	return p.client.GetGrant(ctx, req)
+}
+
+func (p *PAMService) RequestGrant(ctx context.Context, parent Parent, entitlement, reason string, duration int64) (*privilegedaccessmanagerpb.Grant, error) {
 	req := &privilegedaccessmanagerpb.CreateGrantRequest{
-		Parent: fmt.Sprintf("projects/%s/locations/global/entitlements/%s", projectId, entitlement),
+		Parent: parent.EntitlementName(entitlement),
 		Grant: &privilegedaccessmanagerpb.Grant{
 			RequestedDuration: &durationpb.Duration{Seconds: duration},
 			Justification: &privilegedaccessmanagerpb.Justification{
@@ -80,18 +125,47 @@ func (p *PAMService) RequestGrant(ctx context.Context, projectId, entitlement, r
 	return p.client.CreateGrant(ctx, req)
 }
 
-func (p *PAMService) ApproveGrant(ctx context.Context, id, projectId, entitlement, reason string) (*privilegedaccessmanagerpb.Grant, error) {
+func (p *PAMService) ApproveGrant(ctx context.Context, parent Parent, entitlement, id, reason string) (*privilegedaccessmanagerpb.Grant, error) {
 	req := &privilegedaccessmanagerpb.ApproveGrantRequest{
-		Name:   fmt.Sprintf("projects/%s/locations/global/entitlements/%s/grants/%s", projectId, entitlement, id),
+		Name:   parent.GrantName(entitlement, id),
 		Reason: reason,
 	}
 
 	return p.client.ApproveGrant(ctx, req)
 }
 
-func (p *PAMService) RevokeGrant(ctx context.Context, id, projectId, entitlement, reason string) (*privilegedaccessmanagerpb.Grant, error) {
+func (p *PAMService) DenyGrant(ctx context.Context, parent Parent, entitlement, id, reason string) (*privilegedaccessmanagerpb.Grant, error) {
+	req := &privilegedaccessmanagerpb.DenyGrantRequest{
+		Name:   parent.GrantName(entitlement, id),
+		Reason: reason,
+	}
+
+	return p.client.DenyGrant(ctx, req)
+}
+
+// RevokeGrant revokes the grant and waits for the operation to finish
+func (p *PAMService) RevokeGrant(ctx context.Context, parent Parent, entitlement, id, reason string) (*privilegedaccessmanagerpb.Grant, error) {
+	op, err := p.revokeGrant(ctx, parent, entitlement, id, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return op.Wait(ctx)
+}
+
+// RevokeGrantAsync starts revoking the grant and returns the name of the operation
+func (p *PAMService) RevokeGrantAsync(ctx context.Context, parent Parent, entitlement, id, reason string) (string, error) {
+	op, err := p.revokeGrant(ctx, parent, entitlement, id, reason)
+	if err != nil {
+		return "", err
+	}
+
+	return op.Name(), nil
+}
+
+func (p *PAMService) revokeGrant(ctx context.Context, parent Parent, entitlement, id, reason string) (*privilegedaccessmanager.RevokeGrantOperation, error) {
 	req := &privilegedaccessmanagerpb.RevokeGrantRequest{
-		Name:   fmt.Sprintf("projects/%s/locations/global/entitlements/%s/grants/%s", projectId, entitlement, id),
+		Name:   parent.GrantName(entitlement, id),
 		Reason: reason,
 	}
 
@@ -100,5 +174,5 @@ func (p *PAMService) RevokeGrant(ctx context.Context, id, projectId, entitlement
 		return nil, fmt.Errorf("failed to revoke grant: %v", err)
 	}
 
-	return op.Wait(ctx)
+	return op, nil
 }
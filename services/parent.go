@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultLocation = "global"
+
+// Parent is the resource that owns entitlements: a project, folder or organization in a location
+type Parent struct {
+	// Resource is projects/{project}, folders/{folder} or organizations/{organization}
+	Resource string
+	Location string
+}
+
+// ParseParent parses projects/{project}, folders/{folder} or organizations/{organization}, optionally
+// followed by /locations/{location}. A bare project ID is accepted as projects/{project}. Location
+// overrides the location in the resource, and defaults to global.
+func ParseParent(resource, location string) (Parent, error) {
+	parts := strings.Split(resource, "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		parts = []string{"projects", parts[0]}
+	case len(parts) == 4 && parts[2] == "locations" && parts[3] != "":
+		if location == "" {
+			location = parts[3]
+		}
+		parts = parts[:2]
+	}
+
+	if len(parts) != 2 || parts[1] == "" {
+		return Parent{}, fmt.Errorf("invalid parent: %q", resource)
+	}
+
+	switch parts[0] {
+	case "projects", "folders", "organizations":
+	default:
+		return Parent{}, fmt.Errorf("invalid parent: %q, must be a project, folder or organization", resource)
+	}
+
+	if location == "" {
+		location = defaultLocation
+	}
+
+	return Parent{
+		Resource: strings.Join(parts, "/"),
+		Location: location,
+	}, nil
+}
+
+// String returns the location name, e.g. folders/123/locations/global
+func (p Parent) String() string {
+	return fmt.Sprintf("%s/locations/%s", p.Resource, p.Location)
+}
+
+// EntitlementName returns the name of an entitlement under the parent
+func (p Parent) EntitlementName(entitlement string) string {
+	return fmt.Sprintf("%s/entitlements/%s", p, entitlement)
+}
+
+// GrantName returns the name of a grant under an entitlement of the parent
+func (p Parent) GrantName(entitlement, id string) string {
+	return fmt.Sprintf("%s/grants/%s", p.EntitlementName(entitlement), id)
+}
+
+// ResourceType returns the Cloud Resource Manager type of the parent, as used in GcpIamAccess
+func (p Parent) ResourceType() string {
+	switch {
+	case strings.HasPrefix(p.Resource, "folders/"):
+		return "cloudresourcemanager.googleapis.com/Folder"
+	case strings.HasPrefix(p.Resource, "organizations/"):
+		return "cloudresourcemanager.googleapis.com/Organization"
+	default:
+		return "cloudresourcemanager.googleapis.com/Project"
+	}
+}
+
+// FullResourceName returns the full resource name of the parent, as used in GcpIamAccess
+func (p Parent) FullResourceName() string {
+	return "//cloudresourcemanager.googleapis.com/" + p.Resource
+}
+
+// ParseGrantName splits a grant resource name of the form
+// {parent}/locations/{location}/entitlements/{entitlement}/grants/{grant}
+func ParseGrantName(name string) (parent Parent, entitlement, id string, err error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 8 || parts[2] != "locations" || parts[4] != "entitlements" || parts[6] != "grants" ||
+		parts[3] == "" || parts[5] == "" || parts[7] == "" {
+		return Parent{}, "", "", fmt.Errorf("invalid grant name: %s", name)
+	}
+
+	parent, err = ParseParent(strings.Join(parts[:2], "/"), parts[3])
+	if err != nil {
+		return Parent{}, "", "", err
+	}
+
+	return parent, parts[5], parts[7], nil
+}
+
+// ParseEntitlementName splits an entitlement resource name of the form
+// {parent}/locations/{location}/entitlements/{entitlement}
+func ParseEntitlementName(name string) (parent Parent, entitlement string, err error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[2] != "locations" || parts[4] != "entitlements" ||
+		parts[3] == "" || parts[5] == "" {
+		return Parent{}, "", fmt.Errorf("invalid entitlement name: %s", name)
+	}
+
+	parent, err = ParseParent(strings.Join(parts[:2], "/"), parts[3])
+	if err != nil {
+		return Parent{}, "", err
+	}
+
+	return parent, parts[5], nil
+}
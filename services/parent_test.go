@@ -0,0 +1,115 @@
+package services
+
+import "testing"
+
+func TestParseParent(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		location string
+		want     Parent
+		wantErr  bool
+	}{
+		{"bare project", "my-project", "", Parent{Resource: "projects/my-project", Location: "global"}, false},
+		{"bare project with location", "my-project", "europe-west1", Parent{Resource: "projects/my-project", Location: "europe-west1"}, false},
+		{"project", "projects/my-project", "", Parent{Resource: "projects/my-project", Location: "global"}, false},
+		{"folder", "folders/123", "", Parent{Resource: "folders/123", Location: "global"}, false},
+		{"organization", "organizations/456", "", Parent{Resource: "organizations/456", Location: "global"}, false},
+		{"resource location", "folders/123/locations/us-central1", "", Parent{Resource: "folders/123", Location: "us-central1"}, false},
+		{"location overrides resource location", "projects/p/locations/us-central1", "europe-west1", Parent{Resource: "projects/p", Location: "europe-west1"}, false},
+		{"empty", "", "", Parent{}, true},
+		{"unknown type", "billingAccounts/123", "", Parent{}, true},
+		{"missing id", "projects/", "", Parent{}, true},
+		{"empty location", "projects/p/locations/", "", Parent{}, true},
+		{"not locations", "projects/p/regions/us-central1", "", Parent{}, true},
+		{"too long", "projects/p/locations/global/entitlements/e", "", Parent{}, true},
+		{"leading slash", "/projects/p", "", Parent{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseParent(tt.resource, tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseParent(%q, %q) error = %v, want error %v", tt.resource, tt.location, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseParent(%q, %q) = %+v, want %+v", tt.resource, tt.location, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGrantName(t *testing.T) {
+	tests := []struct {
+		name            string
+		grant           string
+		wantParent      Parent
+		wantEntitlement string
+		wantID          string
+		wantErr         bool
+	}{
+		{
+			name:            "project",
+			grant:           "projects/my-project/locations/global/entitlements/prod-admin/grants/abc",
+			wantParent:      Parent{Resource: "projects/my-project", Location: "global"},
+			wantEntitlement: "prod-admin",
+			wantID:          "abc",
+		},
+		{
+			name:            "folder",
+			grant:           "folders/123/locations/global/entitlements/break-glass/grants/abc",
+			wantParent:      Parent{Resource: "folders/123", Location: "global"},
+			wantEntitlement: "break-glass",
+			wantID:          "abc",
+		},
+		{
+			name:            "organization",
+			grant:           "organizations/456/locations/global/entitlements/org-admin/grants/abc",
+			wantParent:      Parent{Resource: "organizations/456", Location: "global"},
+			wantEntitlement: "org-admin",
+			wantID:          "abc",
+		},
+		{
+			name:            "non-global location",
+			grant:           "projects/my-project/locations/europe-west1/entitlements/prod-admin/grants/abc",
+			wantParent:      Parent{Resource: "projects/my-project", Location: "europe-west1"},
+			wantEntitlement: "prod-admin",
+			wantID:          "abc",
+		},
+		{name: "entitlement name", grant: "projects/my-project/locations/global/entitlements/prod-admin", wantErr: true},
+		{name: "bare project", grant: "my-project/locations/global/entitlements/prod-admin/grants/abc", wantErr: true},
+		{name: "unknown type", grant: "billingAccounts/1/locations/global/entitlements/prod-admin/grants/abc", wantErr: true},
+		{name: "wrong collection", grant: "projects/my-project/locations/global/policies/prod-admin/grants/abc", wantErr: true},
+		{name: "empty location", grant: "projects/my-project/locations//entitlements/prod-admin/grants/abc", wantErr: true},
+		{name: "empty entitlement", grant: "projects/my-project/locations/global/entitlements//grants/abc", wantErr: true},
+		{name: "empty id", grant: "projects/my-project/locations/global/entitlements/prod-admin/grants/", wantErr: true},
+		{name: "trailing segment", grant: "projects/my-project/locations/global/entitlements/prod-admin/grants/abc/x", wantErr: true},
+		{name: "empty", grant: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, entitlement, id, err := ParseGrantName(tt.grant)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGrantName(%q) error = %v, want error %v", tt.grant, err, tt.wantErr)
+			}
+			if parent != tt.wantParent || entitlement != tt.wantEntitlement || id != tt.wantID {
+				t.Errorf("ParseGrantName(%q) = %+v, %q, %q, want %+v, %q, %q", tt.grant, parent, entitlement, id, tt.wantParent, tt.wantEntitlement, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestParentNames(t *testing.T) {
+	parent := Parent{Resource: "folders/123", Location: "europe-west1"}
+
+	if got, want := parent.GrantName("break-glass", "abc"), "folders/123/locations/europe-west1/entitlements/break-glass/grants/abc"; got != want {
+		t.Errorf("GrantName() = %q, want %q", got, want)
+	}
+
+	// Names built from a parent parse back to it
+	got, entitlement, id, err := ParseGrantName(parent.GrantName("break-glass", "abc"))
+	if err != nil || got != parent || entitlement != "break-glass" || id != "abc" {
+		t.Errorf("ParseGrantName() = %+v, %q, %q, %v", got, entitlement, id, err)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/privilegedaccessmanager/apiv1/privilegedaccessmanagerpb"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// ApproveGrantActionID and DenyGrantActionID identify the buttons on approval messages,
+	// the button value is the full grant name
+	ApproveGrantActionID = "approve_grant"
+	DenyGrantActionID    = "deny_grant"
+)
+
+type SlackService struct {
+	client          *slack.Client
+	approverChannel string
+}
+
+// NewSlackService creates a Slack client for the bot token. If approverChannel is empty,
+// no approval messages are posted.
+func NewSlackService(token, approverChannel string) *SlackService {
+	return &SlackService{
+		client:          slack.New(token),
+		approverChannel: approverChannel,
+	}
+}
+
+// GetUserEmail looks up the email address on the Slack profile of the given user.
+// The bot token needs the users:read.email scope for the email to be returned.
+func (s *SlackService) GetUserEmail(ctx context.Context, userID string) (string, error) {
+	user, err := s.client.GetUserInfoContext(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get slack user: %v", err)
+	}
+
+	if user.Profile.Email == "" {
+		return "", fmt.Errorf("slack user %s has no email address", userID)
+	}
+
+	return user.Profile.Email, nil
+}
+
+// NotifyApprovers posts an approval message with Approve and Deny buttons to the approver channel
+// when the grant is waiting for approval.
+func (s *SlackService) NotifyApprovers(ctx context.Context, grant *privilegedaccessmanagerpb.Grant) error {
+	if s.approverChannel == "" || grant.GetState() != privilegedaccessmanagerpb.Grant_APPROVAL_AWAITED {
+		return nil
+	}
+
+	approve := slack.NewButtonBlockElement(ApproveGrantActionID, grant.Name, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false)).
+		WithStyle(slack.StylePrimary)
+	deny := slack.NewButtonBlockElement(DenyGrantActionID, grant.Name, slack.NewTextBlockObject(slack.PlainTextType, "Deny", false, false)).
+		WithStyle(slack.StyleDanger)
+
+	blocks := append(grantBlocks(grant), slack.NewActionBlock("grant_actions", approve, deny))
+
+	if _, _, err := s.client.PostMessageContext(ctx, s.approverChannel,
+		slack.MsgOptionText(grantSummary(grant), false),
+		slack.MsgOptionBlocks(blocks...),
+	); err != nil {
+		return fmt.Errorf("failed to post approval message: %v", err)
+	}
+
+	return nil
+}
+
+// UpdateApprovalMessage replaces the buttons of an approval message with who acted on the grant
+// and the resulting grant state.
+func (s *SlackService) UpdateApprovalMessage(ctx context.Context, channel, timestamp, actor string, grant *privilegedaccessmanagerpb.Grant) error {
+	outcome := slack.NewContextBlock("grant_outcome",
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("<@%s> acted on this request, grant is now *%s*", actor, grant.GetState().String()), false, false),
+	)
+
+	blocks := append(grantBlocks(grant), outcome)
+
+	if _, _, _, err := s.client.UpdateMessageContext(ctx, channel, timestamp,
+		slack.MsgOptionText(grantSummary(grant), false),
+		slack.MsgOptionBlocks(blocks...),
+	); err != nil {
+		return fmt.Errorf("failed to update approval message: %v", err)
+	}
+
+	return nil
+}
+
+// RespondEphemeral replies only to the user behind an interaction or slash command through its response URL
+func (s *SlackService) RespondEphemeral(ctx context.Context, responseURL, text string) error {
+	if err := slack.PostWebhookContext(ctx, responseURL, &slack.WebhookMessage{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         text,
+	}); err != nil {
+		return fmt.Errorf("failed to respond through response URL: %v", err)
+	}
+
+	return nil
+}
+
+func grantSummary(grant *privilegedaccessmanagerpb.Grant) string {
+	return fmt.Sprintf("%s requests access to %s for %s", grant.GetRequester(), grant.GetName(), grant.GetRequestedDuration().AsDuration())
+}
+
+func grantBlocks(grant *privilegedaccessmanagerpb.Grant) []slack.Block {
+	var roles []string
+	for _, role := range grant.GetPrivilegedAccess().GetGcpIamAccess().GetRoleBindings() {
+		roles = append(roles, fmt.Sprintf("`%s`", role.Role))
+	}
+
+	fields := []*slack.TextBlockObject{
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Requester*\n%s", grant.GetRequester()), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Duration*\n%s", grant.GetRequestedDuration().AsDuration().Round(time.Minute)), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Grant*\n`%s`", grant.GetName()), false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Roles*\n%s", strings.Join(roles, ", ")), false, false),
+	}
+
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*Privileged access request*", false, false), fields, nil),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Justification*\n%s", grant.GetJustification().GetUnstructuredJustification()), false, false), nil, nil),
+	}
+}